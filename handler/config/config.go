@@ -0,0 +1,343 @@
+package config
+
+import (
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	// the runner image has no zoneinfo
+	_ "time/tzdata"
+
+	"gopkg.in/yaml.v3"
+)
+
+// redacted replaces secrets when the config is printed
+const redacted = "***"
+
+type Config struct {
+	Timezone string    `yaml:"timezone" json:"timezone"`
+	HTTP     HTTP      `yaml:"http" json:"http"`
+	Database Database  `yaml:"database" json:"database"`
+	Telegram Telegram  `yaml:"telegram" json:"telegram"`
+	Reserve  Reserve   `yaml:"reserve" json:"reserve"`
+	Reminder Reminder  `yaml:"reminder" json:"reminder"`
+	API      API       `yaml:"api" json:"api"`
+	Webhooks []Webhook `yaml:"webhooks" json:"webhooks"`
+
+	location *time.Location
+}
+
+type HTTP struct {
+	Addr            string   `yaml:"addr" json:"addr"`
+	ShutdownTimeout Duration `yaml:"shutdown_timeout" json:"shutdown_timeout"`
+
+	// PublicURL is where the server is reachable, used in calendar links
+	PublicURL string `yaml:"public_url" json:"public_url"`
+	WebAppURL string `yaml:"webapp_url" json:"webapp_url"`
+}
+
+type Database struct {
+	Host     string `yaml:"host" json:"host"`
+	Port     string `yaml:"port" json:"port"`
+	Name     string `yaml:"name" json:"name"`
+	User     string `yaml:"user" json:"user"`
+	Password string `yaml:"password" json:"password"`
+	SSLMode  string `yaml:"sslmode" json:"sslmode"`
+}
+
+type Telegram struct {
+	Token string `yaml:"token" json:"token"`
+	// APIURL replaces https://api.telegram.org, for a local bot API server or telegramtest
+	APIURL        string   `yaml:"api_url" json:"api_url"`
+	Mode          string   `yaml:"mode" json:"mode"`
+	WebhookURL    string   `yaml:"webhook_url" json:"webhook_url"`
+	WebhookPath   string   `yaml:"webhook_path" json:"webhook_path"`
+	WebhookSecret string   `yaml:"webhook_secret" json:"webhook_secret"`
+	Workers       int      `yaml:"workers" json:"workers"`
+	Admins        []string `yaml:"admins" json:"admins"`
+}
+
+type Reserve struct {
+	// Cutoff is the time of the day before, after which a day can't be changed
+	Cutoff       ClockTime `yaml:"cutoff" json:"cutoff"`
+	PlanningDays int       `yaml:"planning_days" json:"planning_days"`
+}
+
+type Reminder struct {
+	Weekday Weekday   `yaml:"weekday" json:"weekday"`
+	Time    ClockTime `yaml:"time" json:"time"`
+
+	// Cron replaces Weekday and Time when set, like "0 15 * * fri"
+	Cron string `yaml:"cron" json:"cron"`
+}
+
+// CronExpression returns the schedule of the reminder as a cron expression, in the timezone of the config.
+func (r Reminder) CronExpression() string {
+
+	if r.Cron != "" {
+		return r.Cron
+	}
+
+	clock := time.Duration(r.Time)
+
+	return fmt.Sprintf("%d %d * * %d", int(clock.Minutes())%60, int(clock.Hours()), int(r.Weekday))
+}
+
+type API struct {
+	Token        string `yaml:"token" json:"token"`
+	AdminToken   string `yaml:"admin_token" json:"admin_token"`
+	KitchenToken string `yaml:"kitchen_token" json:"kitchen_token"`
+}
+
+// Webhook receives the published events listed in Events, or all of them when it's empty.
+type Webhook struct {
+	URL    string   `yaml:"url" json:"url"`
+	Secret string   `yaml:"secret" json:"secret"`
+	Events []string `yaml:"events" json:"events"`
+}
+
+func Default() *Config {
+	return &Config{
+		Timezone: "Asia/Tehran",
+		HTTP: HTTP{
+			Addr:            ":8085",
+			ShutdownTimeout: Duration(10 * time.Second),
+		},
+		Database: Database{
+			Host:     "127.0.0.1",
+			Port:     "5432",
+			Name:     "luncher",
+			User:     "postgres",
+			Password: "postgres",
+			SSLMode:  "disable",
+		},
+		Telegram: Telegram{
+			Mode:        "polling",
+			WebhookPath: "/telegram/webhook",
+			Workers:     8,
+		},
+		Reserve: Reserve{
+			Cutoff:       ClockTime(17*time.Hour + 30*time.Minute),
+			PlanningDays: 14,
+		},
+		Reminder: Reminder{
+			Weekday: Weekday(time.Friday),
+			Time:    ClockTime(15 * time.Hour),
+		},
+	}
+}
+
+// Load reads the defaults, then the optional YAML or JSON file at path, then the environment.
+// The result must be checked with Validate before running the bot.
+func Load(path string) (*Config, error) {
+
+	config := Default()
+
+	if path != "" {
+		if err := config.readFile(path); err != nil {
+			return nil, fmt.Errorf("config file %s: %w", path, err)
+		}
+	}
+
+	if err := config.readEnv(); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+func (c *Config) readFile(path string) error {
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	switch filepath.Ext(path) {
+	case ".yaml", ".yml":
+		return yaml.Unmarshal(data, c)
+	case ".json":
+		return json.Unmarshal(data, c)
+	default:
+		return fmt.Errorf("unknown format, expected .yaml, .yml or .json")
+	}
+}
+
+// readEnv overrides the config with the environment variables that are set.
+func (c *Config) readEnv() error {
+
+	errs := []error{}
+
+	envString(&c.Timezone, "TIMEZONE")
+
+	envString(&c.HTTP.Addr, "HTTP_ADDR")
+	envText(&c.HTTP.ShutdownTimeout, "SHUTDOWN_TIMEOUT", &errs)
+	envString(&c.HTTP.PublicURL, "PUBLIC_URL")
+	envString(&c.HTTP.WebAppURL, "WEBAPP_URL")
+
+	envString(&c.Database.Host, "DB_HOST")
+	envString(&c.Database.Port, "DB_PORT")
+	envString(&c.Database.Name, "DB_NAME")
+	envString(&c.Database.User, "DB_USER")
+	envString(&c.Database.Password, "DB_PASSWORD")
+	envString(&c.Database.SSLMode, "DB_SSLMODE")
+
+	envString(&c.Telegram.Token, "TELEGRAM_BOT_TOKEN")
+	envString(&c.Telegram.APIURL, "TELEGRAM_API_URL")
+	envString(&c.Telegram.Mode, "TELEGRAM_MODE")
+	envString(&c.Telegram.WebhookURL, "TELEGRAM_WEBHOOK_URL")
+	envString(&c.Telegram.WebhookPath, "TELEGRAM_WEBHOOK_PATH")
+	envString(&c.Telegram.WebhookSecret, "TELEGRAM_WEBHOOK_SECRET")
+	envInt(&c.Telegram.Workers, "TELEGRAM_WORKERS", &errs)
+	envJSON(&c.Telegram.Admins, "ADMINS", &errs)
+
+	envText(&c.Reserve.Cutoff, "RESERVE_CUTOFF", &errs)
+	envInt(&c.Reserve.PlanningDays, "RESERVE_PLANNING_DAYS", &errs)
+
+	envText(&c.Reminder.Weekday, "REMINDER_WEEKDAY", &errs)
+	envText(&c.Reminder.Time, "REMINDER_TIME", &errs)
+	envString(&c.Reminder.Cron, "REMINDER_CRON")
+
+	envString(&c.API.Token, "API_TOKEN")
+	envString(&c.API.AdminToken, "ADMIN_API_TOKEN")
+	envString(&c.API.KitchenToken, "KITCHEN_TOKEN")
+
+	envJSON(&c.Webhooks, "OUTGOING_WEBHOOKS", &errs)
+
+	return errors.Join(errs...)
+}
+
+// Validate checks the config and loads its timezone.
+func (c *Config) Validate() error {
+
+	errs := []error{}
+
+	location, err := time.LoadLocation(c.Timezone)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("timezone (TIMEZONE): %w", err))
+	}
+	c.location = location
+
+	if c.HTTP.Addr == "" {
+		errs = append(errs, errors.New("http.addr (HTTP_ADDR) is required"))
+	}
+
+	if c.HTTP.ShutdownTimeout <= 0 {
+		errs = append(errs, errors.New("http.shutdown_timeout (SHUTDOWN_TIMEOUT) must be positive"))
+	}
+
+	if c.Telegram.Token == "" {
+		errs = append(errs, errors.New("telegram.token (TELEGRAM_BOT_TOKEN) is required"))
+	}
+
+	switch c.Telegram.Mode {
+	case "polling":
+	case "webhook":
+		if c.Telegram.WebhookURL == "" || c.Telegram.WebhookSecret == "" {
+			errs = append(errs, errors.New("telegram.webhook_url (TELEGRAM_WEBHOOK_URL) and telegram.webhook_secret (TELEGRAM_WEBHOOK_SECRET) are required in webhook mode"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("telegram.mode (TELEGRAM_MODE) must be polling or webhook, got %q", c.Telegram.Mode))
+	}
+
+	if c.Telegram.Workers < 1 {
+		errs = append(errs, errors.New("telegram.workers (TELEGRAM_WORKERS) must be a positive number"))
+	}
+
+	if c.Reserve.PlanningDays < 1 {
+		errs = append(errs, errors.New("reserve.planning_days (RESERVE_PLANNING_DAYS) must be a positive number"))
+	}
+
+	for i, webhook := range c.Webhooks {
+		if webhook.URL == "" || webhook.Secret == "" {
+			errs = append(errs, fmt.Errorf("webhooks[%d] (OUTGOING_WEBHOOKS): url and secret are required", i))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Location returns the timezone of the config, loaded by Validate.
+func (c *Config) Location() *time.Location {
+	return c.location
+}
+
+// String returns the config as YAML with the secrets redacted.
+func (c Config) String() string {
+
+	redact(&c.Database.Password)
+	redact(&c.Telegram.Token)
+	redact(&c.Telegram.WebhookSecret)
+	redact(&c.API.Token)
+	redact(&c.API.AdminToken)
+	redact(&c.API.KitchenToken)
+
+	c.Webhooks = append([]Webhook{}, c.Webhooks...)
+	for i := range c.Webhooks {
+		redact(&c.Webhooks[i].Secret)
+	}
+
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return err.Error()
+	}
+
+	return string(data)
+}
+
+func redact(secret *string) {
+	if *secret != "" {
+		*secret = redacted
+	}
+}
+
+func envString(target *string, key string) {
+	if value := os.Getenv(key); value != "" {
+		*target = value
+	}
+}
+
+func envInt(target *int, key string, errs *[]error) {
+
+	value := os.Getenv(key)
+	if value == "" {
+		return
+	}
+
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		*errs = append(*errs, fmt.Errorf("%s: %w", key, err))
+		return
+	}
+
+	*target = number
+}
+
+func envText(target encoding.TextUnmarshaler, key string, errs *[]error) {
+
+	value := os.Getenv(key)
+	if value == "" {
+		return
+	}
+
+	if err := target.UnmarshalText([]byte(value)); err != nil {
+		*errs = append(*errs, fmt.Errorf("%s: %w", key, err))
+	}
+}
+
+func envJSON(target any, key string, errs *[]error) {
+
+	value := os.Getenv(key)
+	if value == "" {
+		return
+	}
+
+	if err := json.Unmarshal([]byte(value), target); err != nil {
+		*errs = append(*errs, fmt.Errorf("%s: %w", key, err))
+	}
+}
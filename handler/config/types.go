@@ -0,0 +1,64 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Duration is a time.Duration written like "10s" in config files.
+type Duration time.Duration
+
+func (d *Duration) UnmarshalText(text []byte) error {
+
+	duration, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(duration)
+	return nil
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// ClockTime is a time of day written like "17:30", stored as the duration since midnight.
+type ClockTime time.Duration
+
+func (t *ClockTime) UnmarshalText(text []byte) error {
+
+	clock, err := time.Parse("15:04", string(text))
+	if err != nil {
+		return fmt.Errorf("invalid time %q, expected HH:MM", text)
+	}
+
+	*t = ClockTime(time.Duration(clock.Hour())*time.Hour + time.Duration(clock.Minute())*time.Minute)
+	return nil
+}
+
+func (t ClockTime) MarshalText() ([]byte, error) {
+
+	duration := time.Duration(t)
+	return []byte(fmt.Sprintf("%02d:%02d", int(duration.Hours()), int(duration.Minutes())%60)), nil
+}
+
+// Weekday is a day of the week written like "friday".
+type Weekday time.Weekday
+
+func (w *Weekday) UnmarshalText(text []byte) error {
+
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		if strings.EqualFold(day.String(), string(text)) {
+			*w = Weekday(day)
+			return nil
+		}
+	}
+
+	return fmt.Errorf("invalid weekday %q", text)
+}
+
+func (w Weekday) MarshalText() ([]byte, error) {
+	return []byte(strings.ToLower(time.Weekday(w).String())), nil
+}
@@ -1,8 +1,12 @@
 package database
 
 import (
+	"context"
 	"fmt"
-	"luncher/handler/utils"
+	"log"
+	"luncher/handler/config"
+	"luncher/handler/metrics"
+	"luncher/handler/migrations"
 	"sync"
 
 	"gorm.io/driver/postgres"
@@ -16,29 +20,62 @@ type DbConn struct {
 var (
 	db   *DbConn
 	once sync.Once
+	conf = config.Default().Database
 )
 
+// Configure sets the connection settings, it must be called before the first Connection.
+func Configure(database config.Database) {
+	conf = database
+}
+
 func Connection() *DbConn {
 	once.Do(func() {
-		host := utils.Getenv("DB_HOST", "127.0.0.1")
-		port := utils.Getenv("DB_PORT", "5432")
-		dbname := utils.Getenv("DB_NAME", "luncher")
-		user := utils.Getenv("DB_USER", "postgres")
-		password := utils.Getenv("DB_PASSWORD", "postgres")
-		sslmode := utils.Getenv("DB_SSLMODE", "disable")
-
-		dsn := fmt.Sprintf("host=%s port=%s dbname=%s user=%s password=%s sslmode=%s", host, port, dbname, user, password, sslmode)
+		dsn := fmt.Sprintf("host=%s port=%s dbname=%s user=%s password=%s sslmode=%s", conf.Host, conf.Port, conf.Name, conf.User, conf.Password, conf.SSLMode)
 
 		conn, err := gorm.Open(postgres.Open(dsn), &gorm.Config{
 			PrepareStmt: true,
 		})
 		CheckError(err)
 
+		err = conn.Use(metrics.GormPlugin{})
+		CheckError(err)
+
 		db = &DbConn{Conn: conn}
 	})
 	return db
 }
 
+// Migrate applies the pending schema migrations.
+func Migrate() error {
+
+	sqlDB, err := Connection().Conn.DB()
+	if err != nil {
+		return err
+	}
+
+	count, err := migrations.Up(context.Background(), sqlDB)
+	if count > 0 {
+		log.Printf("Applied %d migrations", count)
+	}
+
+	return err
+}
+
+// Close closes the connection pool, if a connection was made.
+func Close() error {
+
+	if db == nil {
+		return nil
+	}
+
+	sqlDB, err := db.Conn.DB()
+	if err != nil {
+		return err
+	}
+
+	return sqlDB.Close()
+}
+
 func CheckError(err error) {
 	if err != nil {
 		panic(err)
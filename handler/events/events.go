@@ -0,0 +1,118 @@
+package events
+
+import (
+	"log"
+	"luncher/handler/metrics"
+	model "luncher/handler/models"
+	"sync"
+	"time"
+)
+
+const (
+	ReserveCreated   = "reserve.created"
+	ReserveUpdated   = "reserve.updated"
+	ReserveCancelled = "reserve.cancelled"
+	SettingsChanged  = "settings.changed"
+	MenuChanged      = "menu.changed"
+	CutoffReached    = "cutoff.reached"
+)
+
+type Event struct {
+	Type string    `json:"type"`
+	Time time.Time `json:"time"`
+	Data any       `json:"data"`
+}
+
+var (
+	subscribers = map[chan Event]struct{}{}
+	listeners   = map[*func(Event)]struct{}{}
+	mutex       sync.RWMutex
+)
+
+// Publish calls the listeners and sends the event to all subscribers, subscribers with a full buffer miss it.
+func Publish(eventType string, data any) {
+
+	event := Event{Type: eventType, Time: time.Now(), Data: data}
+
+	mutex.RLock()
+	called := make([]func(Event), 0, len(listeners))
+	for listener := range listeners {
+		called = append(called, *listener)
+	}
+
+	for subscriber := range subscribers {
+		select {
+		case subscriber <- event:
+		default:
+			metrics.EventsDropped.WithLabelValues(eventType).Inc()
+			log.Printf("event %s dropped, a subscriber buffer is full", eventType)
+		}
+	}
+	mutex.RUnlock()
+
+	// outside the lock, a listener may publish or subscribe
+	for _, listener := range called {
+		listener(event)
+	}
+}
+
+// ReserveData is the published data of reserve events.
+type ReserveData struct {
+	ID        uint   `json:"id"`
+	UserID    uint   `json:"user_id"`
+	Date      string `json:"date"`
+	HasLunch  bool   `json:"has_lunch"`
+	HasDinner bool   `json:"has_dinner"`
+}
+
+// PublishReserve publishes a saved reserve, a reserve without any meal is cancelled.
+func PublishReserve(reserve model.Reserve, created bool) {
+
+	eventType := ReserveUpdated
+	if !reserve.HasLunch && !reserve.HasDinner {
+		eventType = ReserveCancelled
+	} else if created {
+		eventType = ReserveCreated
+	}
+
+	Publish(eventType, ReserveData{
+		ID:        reserve.ID,
+		UserID:    reserve.UserID,
+		Date:      reserve.Date.Format("2006-01-02"),
+		HasLunch:  reserve.HasLunch,
+		HasDinner: reserve.HasDinner,
+	})
+}
+
+// Subscribe returns a channel receiving published events and a function to unsubscribe.
+func Subscribe(buffer int) (<-chan Event, func()) {
+
+	subscriber := make(chan Event, buffer)
+
+	mutex.Lock()
+	subscribers[subscriber] = struct{}{}
+	mutex.Unlock()
+
+	return subscriber, func() {
+		mutex.Lock()
+		delete(subscribers, subscriber)
+		mutex.Unlock()
+	}
+}
+
+// Listen calls fn with every published event, before Publish returns, and returns a function to stop.
+// It's for subscribers that can't miss an event, fn must be quick since it delays the publisher.
+func Listen(fn func(Event)) func() {
+
+	listener := &fn
+
+	mutex.Lock()
+	listeners[listener] = struct{}{}
+	mutex.Unlock()
+
+	return func() {
+		mutex.Lock()
+		delete(listeners, listener)
+		mutex.Unlock()
+	}
+}
@@ -0,0 +1,169 @@
+// Package leader elects one instance among the replicas to run the scheduled jobs.
+package leader
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"luncher/handler/metrics"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// lockKey is the postgres advisory lock held by the leader, next to the migrations lock.
+const lockKey = 7262151
+
+// retryInterval is how often followers try to take the lock, and the leader checks it still holds it.
+const retryInterval = 10 * time.Second
+
+// Elector runs lead while this instance is the leader.
+type Elector interface {
+	// Run campaigns until ctx is done, calling lead each time leadership is won.
+	// The ctx of lead is done when leadership is lost, lead must return then.
+	Run(ctx context.Context, lead func(ctx context.Context))
+
+	IsLeader() bool
+}
+
+// Postgres elects the instance holding a session advisory lock.
+// When the leader stops or loses its connection, postgres releases the lock and a follower takes it within retryInterval.
+type Postgres struct {
+	db     *sql.DB
+	leader atomic.Bool
+}
+
+func NewPostgres(db *sql.DB) *Postgres {
+	return &Postgres{db: db}
+}
+
+func (p *Postgres) Run(ctx context.Context, lead func(ctx context.Context)) {
+
+	for {
+		if conn, acquired := p.acquire(ctx); acquired {
+			p.lead(ctx, conn, lead)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retryInterval):
+		}
+	}
+}
+
+func (p *Postgres) IsLeader() bool {
+	return p.leader.Load()
+}
+
+// acquire tries to take the lock on a connection of its own, the lock belongs to the session.
+func (p *Postgres) acquire(ctx context.Context) (*sql.Conn, bool) {
+
+	conn, err := p.db.Conn(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Println("leader election connection error", err)
+		}
+		return nil, false
+	}
+
+	var acquired bool
+	err = conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", lockKey).Scan(&acquired)
+	if err != nil || !acquired {
+		if err != nil && ctx.Err() == nil {
+			log.Println("leader election error", err)
+		}
+		conn.Close()
+		return nil, false
+	}
+
+	return conn, true
+}
+
+// lead runs lead until ctx is done or the connection holding the lock fails, then releases the lock.
+func (p *Postgres) lead(ctx context.Context, conn *sql.Conn, lead func(ctx context.Context)) {
+
+	leadCtx, cancel := context.WithCancel(ctx)
+
+	p.setLeader(true)
+	log.Println("Became leader, running scheduled jobs")
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		lead(leadCtx)
+	}()
+
+	ticker := time.NewTicker(retryInterval)
+
+	for held := true; held; {
+		select {
+		case <-leadCtx.Done():
+			held = false
+		case <-ticker.C:
+			if err := conn.PingContext(leadCtx); err != nil && leadCtx.Err() == nil {
+				log.Println("Leadership lost", err)
+				held = false
+			}
+		}
+	}
+
+	ticker.Stop()
+	cancel()
+	<-done
+
+	p.setLeader(false)
+
+	if _, err := conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", lockKey); err != nil {
+		log.Println("leader unlock error", err)
+	}
+	conn.Close()
+}
+
+func (p *Postgres) setLeader(leader bool) {
+
+	p.leader.Store(leader)
+
+	if leader {
+		metrics.Leader.Set(1)
+	} else {
+		metrics.Leader.Set(0)
+	}
+}
+
+// Local is always the leader, for a single instance like demo mode.
+type Local struct {
+	leader atomic.Bool
+}
+
+func (l *Local) Run(ctx context.Context, lead func(ctx context.Context)) {
+
+	l.leader.Store(true)
+	metrics.Leader.Set(1)
+
+	lead(ctx)
+
+	l.leader.Store(false)
+	metrics.Leader.Set(0)
+}
+
+func (l *Local) IsLeader() bool {
+	return l.leader.Load()
+}
+
+// All returns a lead func running every job until leadership is lost.
+func All(jobs ...func(ctx context.Context)) func(ctx context.Context) {
+	return func(ctx context.Context) {
+
+		var wg sync.WaitGroup
+		for _, job := range jobs {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				job(ctx)
+			}()
+		}
+
+		wg.Wait()
+	}
+}
@@ -0,0 +1,56 @@
+package messenger
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// APIError is an error response of the telegram bot API.
+type APIError struct {
+	Code        int
+	Description string
+
+	// RetryAfter is set on 429 Too Many Requests, sending again before it fails again
+	RetryAfter time.Duration
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("telegram %d: %s", e.Code, e.Description)
+}
+
+// IsUnreachable reports whether the chat can't receive messages, like when the user blocked the bot.
+func IsUnreachable(err error) bool {
+
+	var apiError *APIError
+	if !errors.As(err, &apiError) {
+		return false
+	}
+
+	return apiError.Code == http.StatusForbidden ||
+		(apiError.Code == http.StatusBadRequest && strings.Contains(apiError.Description, "chat not found"))
+}
+
+// RetryAfter returns how long to wait before sending again, when telegram asked for it.
+func RetryAfter(err error) (time.Duration, bool) {
+
+	var apiError *APIError
+	if errors.As(err, &apiError) && apiError.Code == http.StatusTooManyRequests {
+		return apiError.RetryAfter, true
+	}
+
+	return 0, false
+}
+
+// IsPermanent reports whether sending the same message again would fail the same way, like a bad request.
+func IsPermanent(err error) bool {
+
+	var apiError *APIError
+	if !errors.As(err, &apiError) {
+		return false
+	}
+
+	return apiError.Code >= 400 && apiError.Code < 500 && apiError.Code != http.StatusTooManyRequests
+}
@@ -0,0 +1,46 @@
+package messenger
+
+// Messenger sends messages to chats, it keeps the handlers independent of the telegram client.
+type Messenger interface {
+	// SendMessage sends the message and returns its id.
+	SendMessage(message Message) (int, error)
+	DeleteMessage(chatID int64, messageID int) error
+	AnswerCallback(callbackID string, text string) error
+}
+
+type Message struct {
+	ChatID                int64
+	Text                  string
+	ParseMode             string
+	Keyboard              [][]Button
+	DisableNotification   bool
+	DisableWebPagePreview bool
+}
+
+// Button is an inline keyboard button, it sends Data back unless WebAppURL or SwitchQuery is set.
+type Button struct {
+	Text        string
+	Data        string
+	WebAppURL   string
+	SwitchQuery *string
+}
+
+func NewMessage(chatID int64, text string) Message {
+	return Message{ChatID: chatID, Text: text}
+}
+
+func NewButton(text string, data string) Button {
+	return Button{Text: text, Data: data}
+}
+
+func NewWebAppButton(text string, url string) Button {
+	return Button{Text: text, WebAppURL: url}
+}
+
+func NewSwitchButton(text string, query string) Button {
+	return Button{Text: text, SwitchQuery: &query}
+}
+
+func NewRow(buttons ...Button) []Button {
+	return buttons
+}
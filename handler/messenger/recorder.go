@@ -0,0 +1,97 @@
+package messenger
+
+import "sync"
+
+// Recorder is a fake messenger for tests, it records every call instead of sending it.
+type Recorder struct {
+	mutex         sync.Mutex
+	lastMessageID int
+
+	// Err is returned by every call when set.
+	Err error
+
+	Sent     []SentMessage
+	Deleted  []DeletedMessage
+	Answered []CallbackAnswer
+}
+
+type SentMessage struct {
+	ID int
+	Message
+}
+
+type DeletedMessage struct {
+	ChatID    int64
+	MessageID int
+}
+
+type CallbackAnswer struct {
+	CallbackID string
+	Text       string
+}
+
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
+
+func (r *Recorder) SendMessage(message Message) (int, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.Err != nil {
+		return 0, r.Err
+	}
+
+	r.lastMessageID++
+	r.Sent = append(r.Sent, SentMessage{ID: r.lastMessageID, Message: message})
+
+	return r.lastMessageID, nil
+}
+
+func (r *Recorder) DeleteMessage(chatID int64, messageID int) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.Err != nil {
+		return r.Err
+	}
+
+	r.Deleted = append(r.Deleted, DeletedMessage{ChatID: chatID, MessageID: messageID})
+
+	return nil
+}
+
+func (r *Recorder) AnswerCallback(callbackID string, text string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.Err != nil {
+		return r.Err
+	}
+
+	r.Answered = append(r.Answered, CallbackAnswer{CallbackID: callbackID, Text: text})
+
+	return nil
+}
+
+// LastSent returns the last sent message, ok is false when nothing is sent.
+func (r *Recorder) LastSent() (SentMessage, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if len(r.Sent) == 0 {
+		return SentMessage{}, false
+	}
+
+	return r.Sent[len(r.Sent)-1], true
+}
+
+// Reset forgets all recorded calls.
+func (r *Recorder) Reset() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.Sent = nil
+	r.Deleted = nil
+	r.Answered = nil
+}
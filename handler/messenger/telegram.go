@@ -0,0 +1,128 @@
+package messenger
+
+import (
+	"encoding/json"
+	"net/url"
+	"strconv"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// Telegram sends messages through the telegram bot API.
+type Telegram struct {
+	api *tgbotapi.BotAPI
+}
+
+func NewTelegram(api *tgbotapi.BotAPI) *Telegram {
+	return &Telegram{api: api}
+}
+
+type inlineButton struct {
+	Text              string      `json:"text"`
+	CallbackData      string      `json:"callback_data,omitempty"`
+	SwitchInlineQuery *string     `json:"switch_inline_query,omitempty"`
+	WebApp            *webAppInfo `json:"web_app,omitempty"`
+}
+
+type webAppInfo struct {
+	URL string `json:"url"`
+}
+
+// SendMessage builds the request by hand, tgbotapi v4 doesn't support web app buttons.
+func (t *Telegram) SendMessage(message Message) (int, error) {
+
+	params := url.Values{}
+	params.Set("chat_id", strconv.FormatInt(message.ChatID, 10))
+	params.Set("text", message.Text)
+
+	if message.ParseMode != "" {
+		params.Set("parse_mode", message.ParseMode)
+	}
+
+	if message.DisableNotification {
+		params.Set("disable_notification", "true")
+	}
+
+	if message.DisableWebPagePreview {
+		params.Set("disable_web_page_preview", "true")
+	}
+
+	if len(message.Keyboard) > 0 {
+
+		keyboard := [][]inlineButton{}
+		for _, row := range message.Keyboard {
+
+			buttons := []inlineButton{}
+			for _, button := range row {
+				buttons = append(buttons, toInlineButton(button))
+			}
+
+			keyboard = append(keyboard, buttons)
+		}
+
+		replyMarkup, err := json.Marshal(map[string]any{"inline_keyboard": keyboard})
+		if err != nil {
+			return 0, err
+		}
+
+		params.Set("reply_markup", string(replyMarkup))
+	}
+
+	resp, err := t.api.MakeRequest("sendMessage", params)
+	if err != nil {
+		return 0, apiError(resp, err)
+	}
+
+	var sent tgbotapi.Message
+	if err := json.Unmarshal(resp.Result, &sent); err != nil {
+		return 0, err
+	}
+
+	return sent.MessageID, nil
+}
+
+func (t *Telegram) DeleteMessage(chatID int64, messageID int) error {
+
+	_, err := t.api.DeleteMessage(tgbotapi.DeleteMessageConfig{
+		ChatID:    chatID,
+		MessageID: messageID,
+	})
+
+	return err
+}
+
+func (t *Telegram) AnswerCallback(callbackID string, text string) error {
+
+	_, err := t.api.AnswerCallbackQuery(tgbotapi.NewCallback(callbackID, text))
+
+	return err
+}
+
+func toInlineButton(button Button) inlineButton {
+
+	if button.WebAppURL != "" {
+		return inlineButton{Text: button.Text, WebApp: &webAppInfo{URL: button.WebAppURL}}
+	}
+
+	if button.SwitchQuery != nil {
+		return inlineButton{Text: button.Text, SwitchInlineQuery: button.SwitchQuery}
+	}
+
+	return inlineButton{Text: button.Text, CallbackData: button.Data}
+}
+
+// apiError returns an APIError when telegram answered with an error, or err for network errors.
+func apiError(resp tgbotapi.APIResponse, err error) error {
+
+	if resp.ErrorCode == 0 {
+		return err
+	}
+
+	apiError := &APIError{Code: resp.ErrorCode, Description: resp.Description}
+	if resp.Parameters != nil {
+		apiError.RetryAfter = time.Duration(resp.Parameters.RetryAfter) * time.Second
+	}
+
+	return apiError
+}
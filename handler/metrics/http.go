@@ -0,0 +1,36 @@
+package metrics
+
+import (
+	"net/http"
+	"path"
+	"strconv"
+	"time"
+)
+
+// TelegramTransport measures calls to the telegram bot API, labeled by method and never by the token in the URL.
+func TelegramTransport(next http.RoundTripper) http.RoundTripper {
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+
+		method := path.Base(req.URL.Path)
+		start := time.Now()
+
+		resp, err := next.RoundTrip(req)
+
+		TelegramRequestDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+
+		if err != nil {
+			TelegramRequests.WithLabelValues(method, "error").Inc()
+			return resp, err
+		}
+
+		TelegramRequests.WithLabelValues(method, strconv.Itoa(resp.StatusCode)).Inc()
+
+		return resp, nil
+	})
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
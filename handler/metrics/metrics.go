@@ -0,0 +1,160 @@
+package metrics
+
+import (
+	"log"
+	"luncher/handler/utils"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	Commands = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "luncher_bot_commands_total",
+		Help: "Number of handled bot messages by command.",
+	}, []string{"command"})
+
+	CommandDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "luncher_bot_command_duration_seconds",
+		Help:    "Time spent handling bot messages by command.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"command"})
+
+	Callbacks = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "luncher_bot_callbacks_total",
+		Help: "Number of handled button presses by callback type.",
+	}, []string{"type"})
+
+	CallbackDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "luncher_bot_callback_duration_seconds",
+		Help:    "Time spent handling button presses by callback type.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"type"})
+
+	ReserveChanges = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "luncher_reserve_changes_total",
+		Help: "Number of saved reserve changes by source.",
+	}, []string{"source"})
+
+	CutoffRejections = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "luncher_reserve_cutoff_rejections_total",
+		Help: "Number of reserve changes rejected because the edit time has passed, by source.",
+	}, []string{"source"})
+
+	DBQueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "luncher_db_query_duration_seconds",
+		Help:    "Time spent on database queries by operation and table.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"operation", "table"})
+
+	DBQueryErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "luncher_db_query_errors_total",
+		Help: "Number of failed database queries by operation and table.",
+	}, []string{"operation", "table"})
+
+	TelegramRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "luncher_telegram_requests_total",
+		Help: "Number of telegram bot API calls by method and HTTP status code, code is \"error\" for network errors.",
+	}, []string{"method", "code"})
+
+	TelegramRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "luncher_telegram_request_duration_seconds",
+		Help:    "Time spent on telegram bot API calls by method.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method"})
+
+	Leader = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "luncher_leader",
+		Help: "1 when this instance is the leader running the scheduled jobs.",
+	})
+
+	JobRuns = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "luncher_job_runs_total",
+		Help: "Number of scheduled job runs by job and result.",
+	}, []string{"job", "result"})
+
+	OutboxMessages = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "luncher_outbox_messages_total",
+		Help: "Number of outbox send attempts by result, sent, retry, failed or unreachable.",
+	}, []string{"result"})
+
+	EventsDropped = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "luncher_events_dropped_total",
+		Help: "Number of events missed by a subscriber with a full buffer, by event type.",
+	}, []string{"type"})
+)
+
+// RegisterDailyCounts exports today's lunch and dinner counts, calculated by count on every scrape.
+func RegisterDailyCounts(count func() (lunch int64, dinner int64, err error)) {
+	prometheus.MustRegister(&dailyCountsCollector{count: count})
+}
+
+var dailyCountsDesc = prometheus.NewDesc(
+	"luncher_daily_reserves",
+	"Number of users having the meal today.",
+	[]string{"meal"}, nil,
+)
+
+type dailyCountsCollector struct {
+	count func() (int64, int64, error)
+}
+
+func (c *dailyCountsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- dailyCountsDesc
+}
+
+func (c *dailyCountsCollector) Collect(ch chan<- prometheus.Metric) {
+
+	lunch, dinner, err := c.count()
+	if err != nil {
+		log.Println("daily counts metric error", err)
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(dailyCountsDesc, prometheus.GaugeValue, float64(lunch), "lunch")
+	ch <- prometheus.MustNewConstMetric(dailyCountsDesc, prometheus.GaugeValue, float64(dinner), "dinner")
+}
+
+// RegisterCache exports the stats of the named cache, read by stats on every scrape.
+func RegisterCache(name string, stats func() utils.CacheStats) {
+	prometheus.MustRegister(&cacheCollector{name: name, stats: stats})
+}
+
+var (
+	cacheRequestsDesc = prometheus.NewDesc(
+		"luncher_cache_requests_total",
+		"Number of cache lookups by cache and result.",
+		[]string{"cache", "result"}, nil,
+	)
+	cacheEvictionsDesc = prometheus.NewDesc(
+		"luncher_cache_evictions_total",
+		"Number of items evicted from the cache past its max size.",
+		[]string{"cache"}, nil,
+	)
+	cacheSizeDesc = prometheus.NewDesc(
+		"luncher_cache_size",
+		"Number of items in the cache.",
+		[]string{"cache"}, nil,
+	)
+)
+
+type cacheCollector struct {
+	name  string
+	stats func() utils.CacheStats
+}
+
+func (c *cacheCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- cacheRequestsDesc
+	ch <- cacheEvictionsDesc
+	ch <- cacheSizeDesc
+}
+
+func (c *cacheCollector) Collect(ch chan<- prometheus.Metric) {
+
+	stats := c.stats()
+
+	ch <- prometheus.MustNewConstMetric(cacheRequestsDesc, prometheus.CounterValue, float64(stats.Hits), c.name, "hit")
+	ch <- prometheus.MustNewConstMetric(cacheRequestsDesc, prometheus.CounterValue, float64(stats.Misses), c.name, "miss")
+	ch <- prometheus.MustNewConstMetric(cacheEvictionsDesc, prometheus.CounterValue, float64(stats.Evictions), c.name)
+	ch <- prometheus.MustNewConstMetric(cacheSizeDesc, prometheus.GaugeValue, float64(stats.Size), c.name)
+}
@@ -0,0 +1,284 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// lockKey is the postgres advisory lock held while migrating, so replicas don't migrate at once.
+const lockKey = 7262150
+
+//go:embed sql/*.sql
+var files embed.FS
+
+// Migration is one schema change, read from sql/<version>_<name>.up.sql and .down.sql.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+type Status struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// Load returns the embedded migrations ordered by version.
+func Load() ([]Migration, error) {
+
+	paths, err := fs.Glob(files, "sql/*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, path := range paths {
+
+		name := strings.TrimPrefix(path, "sql/")
+
+		base, direction, found := strings.Cut(strings.TrimSuffix(name, ".sql"), ".")
+		versionString, migrationName, _ := strings.Cut(base, "_")
+
+		version, err := strconv.Atoi(versionString)
+		if !found || err != nil {
+			return nil, fmt.Errorf("invalid migration file name %s, expected <version>_<name>.up.sql or .down.sql", name)
+		}
+
+		content, err := files.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		migration, exists := byVersion[version]
+		if !exists {
+			migration = &Migration{Version: version, Name: migrationName}
+			byVersion[version] = migration
+		}
+
+		switch direction {
+		case "up":
+			migration.Up = string(content)
+		case "down":
+			migration.Down = string(content)
+		default:
+			return nil, fmt.Errorf("invalid migration file name %s, expected .up.sql or .down.sql", name)
+		}
+	}
+
+	migrations := []Migration{}
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %d needs both up and down files", migration.Version)
+		}
+		migrations = append(migrations, *migration)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// Up applies the migrations that are not applied yet and returns how many were applied.
+func Up(ctx context.Context, db *sql.DB) (int, error) {
+
+	migrations, err := Load()
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	err = withLock(ctx, db, func(conn *sql.Conn) error {
+
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range migrations {
+
+			if _, exists := applied[migration.Version]; exists {
+				continue
+			}
+
+			log.Printf("Applying migration %d %s", migration.Version, migration.Name)
+
+			err := inTransaction(ctx, conn, migration.Up,
+				"INSERT INTO schema_migrations (version, name, applied_at) VALUES ($1, $2, now())", migration.Version, migration.Name)
+			if err != nil {
+				return fmt.Errorf("migration %d %s: %w", migration.Version, migration.Name, err)
+			}
+
+			count++
+		}
+
+		return nil
+	})
+
+	return count, err
+}
+
+// Down reverts the last applied migrations, at most steps of them, and returns how many were reverted.
+func Down(ctx context.Context, db *sql.DB, steps int) (int, error) {
+
+	migrations, err := Load()
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	err = withLock(ctx, db, func(conn *sql.Conn) error {
+
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(migrations) - 1; i >= 0 && count < steps; i-- {
+
+			migration := migrations[i]
+			if _, exists := applied[migration.Version]; !exists {
+				continue
+			}
+
+			log.Printf("Reverting migration %d %s", migration.Version, migration.Name)
+
+			err := inTransaction(ctx, conn, migration.Down,
+				"DELETE FROM schema_migrations WHERE version = $1", migration.Version)
+			if err != nil {
+				return fmt.Errorf("migration %d %s: %w", migration.Version, migration.Name, err)
+			}
+
+			count++
+		}
+
+		return nil
+	})
+
+	return count, err
+}
+
+// List returns every migration with the time it was applied, nil when it's pending.
+func List(ctx context.Context, db *sql.DB) ([]Status, error) {
+
+	migrations, err := Load()
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	applied, err := appliedVersions(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := []Status{}
+	for _, migration := range migrations {
+
+		status := Status{Migration: migration}
+		if appliedAt, exists := applied[migration.Version]; exists {
+			status.AppliedAt = &appliedAt
+		}
+
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
+
+// withLock runs migrate on one connection holding the advisory lock, creating schema_migrations first.
+func withLock(ctx context.Context, db *sql.DB, migrate func(conn *sql.Conn) error) error {
+
+	// the lock belongs to the session, so everything runs on the same connection
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", lockKey); err != nil {
+		return fmt.Errorf("lock migrations: %w", err)
+	}
+
+	defer func() {
+		if _, err := conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", lockKey); err != nil {
+			log.Println("unlock migrations error", err)
+		}
+	}()
+
+	_, err = conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version bigint PRIMARY KEY,
+		name varchar(255) NOT NULL,
+		applied_at timestamptz NOT NULL
+	)`)
+	if err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+
+	return migrate(conn)
+}
+
+// appliedVersions returns the applied migration versions with the time they were applied.
+func appliedVersions(ctx context.Context, conn *sql.Conn) (map[int]time.Time, error) {
+
+	applied := map[int]time.Time{}
+
+	rows, err := conn.QueryContext(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		// nothing is applied before the first migrate creates the table
+		if strings.Contains(err.Error(), "does not exist") {
+			return applied, nil
+		}
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+
+		applied[version] = appliedAt
+	}
+
+	return applied, rows.Err()
+}
+
+// inTransaction runs the migration script and its schema_migrations change in one transaction.
+func inTransaction(ctx context.Context, conn *sql.Conn, script string, record string, args ...any) error {
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,159 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// baselineSchema is the schema gorm AutoMigrate created before the migrations, with a user and a reserve.
+const baselineSchema = `
+CREATE TABLE users (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    name varchar(50),
+    username varchar(50),
+    telegram_id bigint CONSTRAINT uni_users_telegram_id UNIQUE,
+    always_lunch boolean DEFAULT false,
+    always_dinner boolean DEFAULT false
+);
+
+CREATE INDEX idx_users_deleted_at ON users (deleted_at);
+
+CREATE TABLE reserves (
+    id bigserial PRIMARY KEY,
+    date timestamptz NOT NULL,
+    user_id bigint CONSTRAINT fk_users_reserves REFERENCES users (id),
+    has_lunch boolean DEFAULT false,
+    has_dinner boolean DEFAULT false,
+    created_at timestamptz,
+    update_at timestamptz
+);
+
+CREATE TABLE meals (
+    id bigserial PRIMARY KEY,
+    lunch varchar(50),
+    dinner varchar(50)
+);
+
+INSERT INTO users (name, username, telegram_id) VALUES ('ali', 'ali', 1);
+INSERT INTO reserves (date, user_id, has_lunch, update_at) VALUES ('2024-11-05', 1, true, now());
+`
+
+// openTestDB opens TEST_DATABASE_DSN, a key=value postgres DSN, in a schema of its own dropped after the test.
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_DSN is not set")
+	}
+
+	schema := fmt.Sprintf("migrations_test_%d", time.Now().UnixNano())
+
+	admin := openDB(t, dsn)
+	if _, err := admin.Exec("CREATE SCHEMA " + schema); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		if _, err := admin.Exec("DROP SCHEMA " + schema + " CASCADE"); err != nil {
+			t.Log("drop schema error", err)
+		}
+		admin.Close()
+	})
+
+	db := openDB(t, dsn+" search_path="+schema)
+	t.Cleanup(func() { db.Close() })
+
+	return db
+}
+
+func openDB(t *testing.T, dsn string) *sql.DB {
+	t.Helper()
+
+	conn, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := conn.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
+
+func TestUpFromBaselineSchema(t *testing.T) {
+
+	db := openTestDB(t)
+	ctx := context.Background()
+
+	if _, err := db.Exec(baselineSchema); err != nil {
+		t.Fatal(err)
+	}
+
+	migrations, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	applied, err := Up(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if applied != len(migrations) {
+		t.Fatalf("applied %d migrations, want %d", applied, len(migrations))
+	}
+
+	var calendarToken sql.NullString
+	var hasLunch bool
+	err = db.QueryRow(`SELECT users.calendar_token, reserves.has_lunch FROM users JOIN reserves ON reserves.user_id = users.id
+		WHERE users.telegram_id = 1 AND reserves.updated_at IS NOT NULL`).Scan(&calendarToken, &hasLunch)
+	if err != nil {
+		t.Fatal("baseline data after migrating:", err)
+	}
+
+	if !hasLunch {
+		t.Fatal("reserve lost its lunch")
+	}
+
+	applied, err = Up(ctx, db)
+	if err != nil || applied != 0 {
+		t.Fatalf("second up applied %d, error %v", applied, err)
+	}
+}
+
+func TestUpFromEmptyDatabase(t *testing.T) {
+
+	db := openTestDB(t)
+	ctx := context.Background()
+
+	if _, err := Up(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+
+	migrations, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reverted, err := Down(ctx, db, len(migrations))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if reverted != len(migrations) {
+		t.Fatalf("reverted %d migrations, want %d", reverted, len(migrations))
+	}
+}
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS webhook_deliveries;
+DROP TABLE IF EXISTS meals;
+DROP TABLE IF EXISTS reserves;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,53 @@
+-- the tables as created by gorm AutoMigrate, existing databases keep theirs
+
+CREATE TABLE IF NOT EXISTS users (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    name varchar(50),
+    username varchar(50),
+    telegram_id bigint CONSTRAINT uni_users_telegram_id UNIQUE,
+    always_lunch boolean DEFAULT false,
+    always_dinner boolean DEFAULT false,
+    calendar_token varchar(64)
+);
+
+-- columns added after the first release, missing in the users tables created before them
+ALTER TABLE users ADD COLUMN IF NOT EXISTS calendar_token varchar(64);
+
+CREATE INDEX IF NOT EXISTS idx_users_deleted_at ON users (deleted_at);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_calendar_token ON users (calendar_token);
+
+CREATE TABLE IF NOT EXISTS reserves (
+    id bigserial PRIMARY KEY,
+    date timestamptz NOT NULL,
+    user_id bigint CONSTRAINT fk_users_reserves REFERENCES users (id),
+    has_lunch boolean DEFAULT false,
+    has_dinner boolean DEFAULT false,
+    created_at timestamptz,
+    update_at timestamptz
+);
+
+CREATE TABLE IF NOT EXISTS meals (
+    id bigserial PRIMARY KEY,
+    lunch varchar(50),
+    dinner varchar(50)
+);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id bigserial PRIMARY KEY,
+    url varchar(255) NOT NULL,
+    event varchar(50) NOT NULL,
+    payload text NOT NULL,
+    status varchar(20) NOT NULL,
+    attempts bigint,
+    last_status_code bigint,
+    last_error text,
+    next_attempt_at timestamptz,
+    delivered_at timestamptz,
+    created_at timestamptz,
+    updated_at timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_status ON webhook_deliveries (status);
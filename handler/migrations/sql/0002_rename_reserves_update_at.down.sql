@@ -0,0 +1 @@
+ALTER TABLE reserves RENAME COLUMN updated_at TO update_at;
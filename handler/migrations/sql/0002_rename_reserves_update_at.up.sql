@@ -0,0 +1 @@
+ALTER TABLE reserves RENAME COLUMN update_at TO updated_at;
@@ -0,0 +1 @@
+ALTER TABLE reserves DROP CONSTRAINT IF EXISTS uni_reserves_user_id_date;
@@ -0,0 +1,11 @@
+-- keep the last changed reserve when a user has more than one for a day
+DELETE FROM reserves
+WHERE id IN (
+    SELECT id FROM (
+        SELECT id, row_number() OVER (PARTITION BY user_id, date ORDER BY updated_at DESC NULLS LAST, id DESC) AS position
+        FROM reserves
+    ) duplicates
+    WHERE position > 1
+);
+
+ALTER TABLE reserves ADD CONSTRAINT uni_reserves_user_id_date UNIQUE (user_id, date);
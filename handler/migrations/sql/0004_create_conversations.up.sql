@@ -0,0 +1,11 @@
+CREATE TABLE conversations (
+    telegram_id bigint PRIMARY KEY,
+    chat_id bigint NOT NULL,
+    wizard varchar(50) NOT NULL,
+    step varchar(50) NOT NULL,
+    data jsonb NOT NULL DEFAULT '{}',
+    expires_at timestamptz NOT NULL,
+    updated_at timestamptz
+);
+
+CREATE INDEX idx_conversations_expires_at ON conversations (expires_at);
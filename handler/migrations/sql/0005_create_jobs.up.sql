@@ -0,0 +1,5 @@
+CREATE TABLE jobs (
+    name varchar(50) PRIMARY KEY,
+    last_run_at timestamptz,
+    updated_at timestamptz
+);
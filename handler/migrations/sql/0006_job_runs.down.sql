@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS job_runs;
+
+ALTER TABLE jobs DROP COLUMN IF EXISTS paused;
@@ -0,0 +1,13 @@
+ALTER TABLE jobs ADD COLUMN paused boolean NOT NULL DEFAULT false;
+
+CREATE TABLE job_runs (
+    id bigserial PRIMARY KEY,
+    name varchar(50) NOT NULL,
+    trigger varchar(20) NOT NULL,
+    scheduled_at timestamptz NOT NULL,
+    started_at timestamptz NOT NULL,
+    finished_at timestamptz,
+    error text
+);
+
+CREATE INDEX idx_job_runs_name ON job_runs (name, started_at);
@@ -0,0 +1,3 @@
+ALTER TABLE users DROP COLUMN IF EXISTS unreachable_at;
+
+DROP TABLE IF EXISTS outbox_messages;
@@ -0,0 +1,15 @@
+CREATE TABLE outbox_messages (
+    id bigserial PRIMARY KEY,
+    chat_id bigint NOT NULL,
+    payload text NOT NULL,
+    status varchar(20) NOT NULL,
+    attempts integer NOT NULL DEFAULT 0,
+    next_attempt_at timestamptz NOT NULL,
+    last_error text,
+    created_at timestamptz,
+    sent_at timestamptz
+);
+
+CREATE INDEX idx_outbox_messages_pending ON outbox_messages (next_attempt_at) WHERE status = 'pending';
+
+ALTER TABLE users ADD COLUMN unreachable_at timestamptz;
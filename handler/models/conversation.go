@@ -0,0 +1,14 @@
+package model
+
+import "time"
+
+// Conversation is the step a user is at in a multi message bot flow, like entering a dish name.
+type Conversation struct {
+	TelegramID int64             `json:"telegram_id" gorm:"primaryKey;autoIncrement:false"`
+	ChatID     int64             `json:"chat_id" gorm:"not null"`
+	Wizard     string            `json:"wizard" gorm:"type:varchar(50);not null"`
+	Step       string            `json:"step" gorm:"type:varchar(50);not null"`
+	Data       map[string]string `json:"data" gorm:"type:jsonb;serializer:json;not null"`
+	ExpiresAt  time.Time         `json:"expires_at" gorm:"index;not null"`
+	UpdatedAt  time.Time         `json:"updated_at"`
+}
@@ -0,0 +1,28 @@
+package model
+
+import "time"
+
+const (
+	JobTriggerSchedule = "schedule"
+	JobTriggerCatchUp  = "catch_up"
+	JobTriggerManual   = "manual"
+)
+
+// Job is the state of a scheduled job, kept so a restart or a new leader doesn't run it twice.
+type Job struct {
+	Name      string     `json:"name" gorm:"type:varchar(50);primaryKey"`
+	Paused    bool       `json:"paused" gorm:"not null;default:false"`
+	LastRunAt *time.Time `json:"last_run_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// JobRun is the history of one run of a job, Error is empty when it succeeded.
+type JobRun struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	Name        string     `json:"name" gorm:"type:varchar(50);index;not null"`
+	Trigger     string     `json:"trigger" gorm:"type:varchar(20);not null"`
+	ScheduledAt time.Time  `json:"scheduled_at" gorm:"not null"`
+	StartedAt   time.Time  `json:"started_at" gorm:"not null"`
+	FinishedAt  *time.Time `json:"finished_at"`
+	Error       string     `json:"error" gorm:"type:text"`
+}
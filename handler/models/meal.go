@@ -1,7 +1,13 @@
 package model
 
+// MenuSlots is the number of days in the menu rotation, two weeks starting from saturday.
+const MenuSlots = 14
+
+// MealNameMaxLength is the max length of a dish name, same as its column size.
+const MealNameMaxLength = 50
+
 type Meal struct {
-	ID     uint   `json:"id" gorm:"primaryKey"`
+	ID     uint    `json:"id" gorm:"primaryKey"`
 	Lunch  *string `json:"lunch" gorm:"type:varchar(50)"`
 	Dinner *string `json:"dinner" gorm:"type:varchar(50)"`
 }
@@ -0,0 +1,23 @@
+package model
+
+import "time"
+
+const (
+	OutboxPending     = "pending"
+	OutboxSent        = "sent"
+	OutboxFailed      = "failed"
+	OutboxUnreachable = "unreachable"
+)
+
+// OutboxMessage is a message waiting to be sent by the outbox worker, Payload is the JSON of a messenger.Message.
+type OutboxMessage struct {
+	ID            uint       `json:"id" gorm:"primaryKey"`
+	ChatID        int64      `json:"chat_id" gorm:"not null"`
+	Payload       string     `json:"payload" gorm:"type:text;not null"`
+	Status        string     `json:"status" gorm:"type:varchar(20);not null"`
+	Attempts      int        `json:"attempts" gorm:"not null;default:0"`
+	NextAttemptAt time.Time  `json:"next_attempt_at" gorm:"not null"`
+	LastError     string     `json:"last_error" gorm:"type:text"`
+	CreatedAt     time.Time  `json:"created_at"`
+	SentAt        *time.Time `json:"sent_at"`
+}
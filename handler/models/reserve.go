@@ -9,7 +9,7 @@ type Reserve struct {
 	HasLunch  bool      `json:"has_lunch" gorm:"default:false"`
 	HasDinner bool      `json:"has_dinner" gorm:"default:false"`
 	CreatedAt time.Time `json:"created_at"`
-	UpdateAt  time.Time `json:"update_at"`
+	UpdatedAt time.Time `json:"updated_at"`
 
 	User User `json:"user" gorm:"foreignKey:UserID"`
 }
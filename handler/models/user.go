@@ -1,6 +1,10 @@
 package model
 
-import "gorm.io/gorm"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
 
 type User struct {
 	gorm.Model
@@ -11,6 +15,11 @@ type User struct {
 	AlwaysLunch  bool   `json:"always_lunch" gorm:"default:false"`
 	AlwaysDinner bool   `json:"always_dinner" gorm:"default:false"`
 
+	CalendarToken *string `json:"-" gorm:"type:varchar(64);uniqueIndex"`
+
+	// UnreachableAt is set when the user blocked the bot, bulk messages skip them until their next message.
+	UnreachableAt *time.Time `json:"-"`
+
 	Reserves []Reserve `json:"reserves" gorm:"foreignKey:UserID"`
 }
 
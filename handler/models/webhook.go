@@ -0,0 +1,25 @@
+package model
+
+import "time"
+
+const (
+	WebhookPending   = "pending"
+	WebhookDelivered = "delivered"
+	WebhookFailed    = "failed"
+)
+
+// WebhookDelivery is the delivery log of one event to one outgoing webhook.
+type WebhookDelivery struct {
+	ID             uint       `json:"id" gorm:"primaryKey"`
+	URL            string     `json:"url" gorm:"type:varchar(255);not null"`
+	Event          string     `json:"event" gorm:"type:varchar(50);not null"`
+	Payload        string     `json:"payload" gorm:"type:text;not null"`
+	Status         string     `json:"status" gorm:"type:varchar(20);index;not null"`
+	Attempts       int        `json:"attempts"`
+	LastStatusCode int        `json:"last_status_code"`
+	LastError      string     `json:"last_error" gorm:"type:text"`
+	NextAttemptAt  time.Time  `json:"next_attempt_at"`
+	DeliveredAt    *time.Time `json:"delivered_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
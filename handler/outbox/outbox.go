@@ -0,0 +1,261 @@
+// Package outbox queues messages in the store and sends them within the telegram rate limits.
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"luncher/handler/messenger"
+	"luncher/handler/metrics"
+	model "luncher/handler/models"
+	"luncher/handler/storage"
+	"time"
+)
+
+const (
+	// globalInterval keeps under the 30 messages per second telegram allows a bot
+	globalInterval = time.Second / 30
+
+	// chatInterval keeps under the one message per second telegram allows in a chat
+	chatInterval = 1 * time.Second
+
+	// pollInterval is how often due messages are read when nothing was enqueued on this instance
+	pollInterval = 5 * time.Second
+
+	batchSize = 100
+
+	maxAttempts = 8
+	baseBackoff = 5 * time.Second
+	maxBackoff  = 1 * time.Hour
+)
+
+// Outbox enqueues messages on any instance, Run sends them on the leader.
+type Outbox struct {
+	store     storage.Store
+	messenger messenger.Messenger
+
+	// wake is signaled when messages are enqueued, so the worker doesn't wait for the next poll
+	wake chan struct{}
+
+	// the worker state, only used by Run
+	nextSend  time.Time
+	chatsNext map[int64]time.Time
+}
+
+func New(store storage.Store, m messenger.Messenger) *Outbox {
+	return &Outbox{
+		store:     store,
+		messenger: m,
+		wake:      make(chan struct{}, 1),
+		chatsNext: map[int64]time.Time{},
+	}
+}
+
+// Enqueue keeps the messages to be sent by the worker.
+func (o *Outbox) Enqueue(messages ...messenger.Message) error {
+
+	now := time.Now()
+
+	queued := []model.OutboxMessage{}
+	for _, message := range messages {
+
+		payload, err := json.Marshal(message)
+		if err != nil {
+			return err
+		}
+
+		queued = append(queued, model.OutboxMessage{
+			ChatID:        message.ChatID,
+			Payload:       string(payload),
+			Status:        model.OutboxPending,
+			NextAttemptAt: now,
+		})
+	}
+
+	if len(queued) == 0 {
+		return nil
+	}
+
+	if err := o.store.EnqueueMessages(queued); err != nil {
+		return err
+	}
+
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// Run sends the due messages until ctx is done, it must run on the leader only.
+func (o *Outbox) Run(ctx context.Context) {
+
+	for {
+		sent := o.sendDue(ctx)
+
+		// a full batch means more are due
+		if sent == batchSize {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-o.wake:
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// sendDue sends a batch of due messages and returns how many were tried.
+func (o *Outbox) sendDue(ctx context.Context) int {
+
+	messages, err := o.store.DueMessages(time.Now(), batchSize)
+	if err != nil {
+		log.Println("due outbox messages error", err)
+		return 0
+	}
+
+	tried := 0
+	for i := range messages {
+
+		message := &messages[i]
+
+		// a chat with several messages gets the next one in a later batch
+		if time.Now().Before(o.chatsNext[message.ChatID]) {
+			continue
+		}
+
+		if !o.waitGlobal(ctx) {
+			return tried
+		}
+
+		o.send(message)
+		tried++
+	}
+
+	o.forgetChats()
+
+	return tried
+}
+
+// waitGlobal waits for the global rate limit, it returns false when ctx is done meanwhile.
+func (o *Outbox) waitGlobal(ctx context.Context) bool {
+
+	if wait := time.Until(o.nextSend); wait > 0 {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(wait):
+		}
+	}
+
+	return ctx.Err() == nil
+}
+
+func (o *Outbox) send(message *model.OutboxMessage) {
+
+	now := time.Now()
+	o.nextSend = now.Add(globalInterval)
+	o.chatsNext[message.ChatID] = now.Add(chatInterval)
+
+	message.Attempts++
+
+	var payload messenger.Message
+	if err := json.Unmarshal([]byte(message.Payload), &payload); err != nil {
+		message.Status = model.OutboxFailed
+		message.LastError = err.Error()
+		o.save(message)
+		return
+	}
+
+	_, err := o.messenger.SendMessage(payload)
+
+	switch retryAfter, limited := messenger.RetryAfter(err); {
+	case err == nil:
+		message.Status = model.OutboxSent
+		message.SentAt = &now
+		message.LastError = ""
+
+	case limited:
+		// telegram limits the whole bot, nothing is sent until then, and it isn't a failed attempt
+		message.Attempts--
+		message.NextAttemptAt = now.Add(retryAfter)
+		message.LastError = err.Error()
+		o.nextSend = message.NextAttemptAt
+
+	case messenger.IsUnreachable(err):
+		message.Status = model.OutboxUnreachable
+		message.LastError = err.Error()
+		o.markUnreachable(message.ChatID)
+
+	case messenger.IsPermanent(err) || message.Attempts >= maxAttempts:
+		message.Status = model.OutboxFailed
+		message.LastError = err.Error()
+
+	default:
+		message.NextAttemptAt = now.Add(backoff(message.Attempts))
+		message.LastError = err.Error()
+	}
+
+	result := message.Status
+	if result == model.OutboxPending {
+		result = "retry"
+		log.Printf("outbox message %d to %d error, attempt %d: %s", message.ID, message.ChatID, message.Attempts, message.LastError)
+	}
+	metrics.OutboxMessages.WithLabelValues(result).Inc()
+
+	o.save(message)
+}
+
+func (o *Outbox) save(message *model.OutboxMessage) {
+	if err := o.store.SaveOutboxMessage(message); err != nil {
+		log.Println("save outbox message error", err)
+	}
+}
+
+// markUnreachable flags the user of the chat, so bulk messages skip them until they message the bot again.
+func (o *Outbox) markUnreachable(chatID int64) {
+
+	user, err := o.store.FindUser(chatID)
+	if errors.Is(err, storage.ErrNotFound) {
+		return
+	}
+	if err != nil {
+		log.Println("find unreachable user error", err)
+		return
+	}
+
+	now := time.Now()
+	user.UnreachableAt = &now
+
+	if err := o.store.SaveUser(&user); err != nil {
+		log.Println("save unreachable user error", err)
+	}
+
+	log.Printf("User %d blocked the bot, marked unreachable", chatID)
+}
+
+// forgetChats drops the chats that can be sent to again, so the map doesn't grow with every user.
+func (o *Outbox) forgetChats() {
+
+	now := time.Now()
+	for chatID, next := range o.chatsNext {
+		if !now.Before(next) {
+			delete(o.chatsNext, chatID)
+		}
+	}
+}
+
+// backoff returns the wait before the next attempt, doubling from baseBackoff up to maxBackoff.
+func backoff(attempts int) time.Duration {
+
+	wait := baseBackoff
+	for i := 1; i < attempts && wait < maxBackoff; i++ {
+		wait *= 2
+	}
+
+	return min(wait, maxBackoff)
+}
@@ -0,0 +1,199 @@
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule returns the next run time of a job after the given time.
+type Schedule interface {
+	Next(after time.Time) time.Time
+}
+
+// cronField is the range of a cron field and the names it accepts.
+type cronField struct {
+	name  string
+	min   int
+	max   int
+	names map[string]int
+}
+
+var (
+	minuteField  = cronField{name: "minute", min: 0, max: 59}
+	hourField    = cronField{name: "hour", min: 0, max: 23}
+	dayField     = cronField{name: "day of month", min: 1, max: 31}
+	monthField   = cronField{name: "month", min: 1, max: 12, names: map[string]int{"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6, "jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12}}
+	weekdayField = cronField{name: "day of week", min: 0, max: 6, names: map[string]int{"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6}}
+)
+
+// descriptors are the shorthands accepted instead of the five fields
+var descriptors = map[string]string{
+	"@hourly":  "0 * * * *",
+	"@daily":   "0 0 * * *",
+	"@weekly":  "0 0 * * 0",
+	"@monthly": "0 0 1 * *",
+}
+
+// Cron is a schedule parsed from a cron expression, in the time zone of its location.
+type Cron struct {
+	expression string
+	location   *time.Location
+
+	minutes  uint64
+	hours    uint64
+	days     uint64
+	months   uint64
+	weekdays uint64
+
+	// anyDay and anyWeekday are set for *, a day matches both fields only when neither is *, like cron
+	anyDay     bool
+	anyWeekday bool
+}
+
+// ParseCron parses "minute hour day-of-month month day-of-week", with *, lists, ranges, steps and
+// jan-dec, sun-sat names, or one of @hourly, @daily, @weekly and @monthly.
+func ParseCron(expression string, location *time.Location) (*Cron, error) {
+
+	fields := strings.Fields(expression)
+	if len(fields) == 1 {
+		if descriptor, found := descriptors[fields[0]]; found {
+			fields = strings.Fields(descriptor)
+		}
+	}
+
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron %q: expected 5 fields, got %d", expression, len(fields))
+	}
+
+	cron := &Cron{
+		expression: expression,
+		location:   location,
+		anyDay:     fields[2] == "*",
+		anyWeekday: fields[4] == "*",
+	}
+
+	var err error
+	targets := []*uint64{&cron.minutes, &cron.hours, &cron.days, &cron.months, &cron.weekdays}
+	for i, field := range []cronField{minuteField, hourField, dayField, monthField, weekdayField} {
+		if *targets[i], err = field.parse(fields[i]); err != nil {
+			return nil, fmt.Errorf("cron %q: %w", expression, err)
+		}
+	}
+
+	return cron, nil
+}
+
+// parse returns the bits of the values matching the field, like "1-5", "*/15" or "mon,wed,fri".
+func (f cronField) parse(text string) (uint64, error) {
+
+	var bits uint64
+	for _, part := range strings.Split(text, ",") {
+
+		rangeText, stepText, hasStep := strings.Cut(part, "/")
+
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepText); err != nil || step < 1 {
+				return 0, fmt.Errorf("invalid %s step %q", f.name, stepText)
+			}
+		}
+
+		from, to := f.min, f.max
+		if rangeText != "*" {
+
+			fromText, toText, isRange := strings.Cut(rangeText, "-")
+
+			var err error
+			if from, err = f.value(fromText); err != nil {
+				return 0, err
+			}
+
+			to = from
+			if isRange {
+				if to, err = f.value(toText); err != nil {
+					return 0, err
+				}
+			} else if hasStep {
+				to = f.max
+			}
+
+			if from > to {
+				return 0, fmt.Errorf("invalid %s range %q", f.name, rangeText)
+			}
+		}
+
+		for value := from; value <= to; value += step {
+			bits |= 1 << value
+		}
+	}
+
+	return bits, nil
+}
+
+func (f cronField) value(text string) (int, error) {
+
+	if value, found := f.names[strings.ToLower(text)]; found {
+		return value, nil
+	}
+
+	value, err := strconv.Atoi(text)
+	if err != nil || value < f.min || value > f.max {
+		return 0, fmt.Errorf("invalid %s %q, expected %d-%d", f.name, text, f.min, f.max)
+	}
+
+	return value, nil
+}
+
+// Next returns the first matching minute after the given time, or the zero time when there is none in five years.
+func (c *Cron) Next(after time.Time) time.Time {
+
+	t := after.In(c.location).Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+
+		if c.months&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, c.location)
+			continue
+		}
+
+		if !c.matchDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, c.location)
+			continue
+		}
+
+		if c.hours&(1<<uint(t.Hour())) == 0 {
+			// not Truncate, it works in UTC and zones like Asia/Tehran are off by half an hour
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, c.location)
+			continue
+		}
+
+		if c.minutes&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+
+		return t
+	}
+
+	return time.Time{}
+}
+
+func (c *Cron) matchDay(t time.Time) bool {
+
+	day := c.days&(1<<uint(t.Day())) != 0
+	weekday := c.weekdays&(1<<uint(t.Weekday())) != 0
+
+	if !c.anyDay && !c.anyWeekday {
+		return day || weekday
+	}
+
+	return day && weekday
+}
+
+func (c *Cron) String() string {
+	return c.expression
+}
@@ -0,0 +1,345 @@
+// Package scheduler runs the jobs registered with a schedule, on the leader only, keeping their runs in the store.
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"luncher/handler/metrics"
+	model "luncher/handler/models"
+	"luncher/handler/storage"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// historySize is the number of runs of a job shown by Status.
+const historySize = 5
+
+// HeartbeatInterval is how often the loop of each job beats while leading, also while waiting for its next run.
+const HeartbeatInterval = 1 * time.Minute
+
+var (
+	ErrUnknownJob = errors.New("unknown job")
+	ErrShutdown   = errors.New("scheduler is shut down")
+)
+
+// RunFunc runs a job for the time it was scheduled at, which is in the past for catch-up runs.
+type RunFunc func(ctx context.Context, scheduledAt time.Time) error
+
+type job struct {
+	name     string
+	schedule Schedule
+	run      RunFunc
+
+	// catchUp is how late a missed run is still run, after a restart or a leader change
+	catchUp time.Duration
+
+	// heartbeat is the unix nano time the loop of the job last beat at, 0 when not leading
+	heartbeat atomic.Int64
+}
+
+func (j *job) beat() {
+	j.heartbeat.Store(time.Now().UnixNano())
+}
+
+// Scheduler keeps the registered jobs, Run starts them.
+type Scheduler struct {
+	store    storage.Jobs
+	location *time.Location
+
+	jobs []*job
+
+	// manual runs are run on any instance, independent of leadership, until Shutdown
+	mutex        sync.Mutex
+	shutdown     bool
+	manualCtx    context.Context
+	cancelManual context.CancelFunc
+	manual       sync.WaitGroup
+}
+
+func New(store storage.Jobs, location *time.Location) *Scheduler {
+
+	manualCtx, cancelManual := context.WithCancel(context.Background())
+
+	return &Scheduler{
+		store:        store,
+		location:     location,
+		manualCtx:    manualCtx,
+		cancelManual: cancelManual,
+	}
+}
+
+// Register adds a job running at the times of the cron expression, in the timezone of the scheduler.
+func (s *Scheduler) Register(name string, expression string, catchUp time.Duration, run RunFunc) error {
+
+	cron, err := ParseCron(expression, s.location)
+	if err != nil {
+		return fmt.Errorf("job %s: %w", name, err)
+	}
+
+	s.RegisterSchedule(name, cron, catchUp, run)
+
+	return nil
+}
+
+// RegisterSchedule adds a job running at the times of schedule.
+func (s *Scheduler) RegisterSchedule(name string, schedule Schedule, catchUp time.Duration, run RunFunc) {
+	s.jobs = append(s.jobs, &job{name: name, schedule: schedule, run: run, catchUp: catchUp})
+}
+
+// Run runs the jobs on schedule until ctx is done, it's the lead func of the leader election.
+// A run missed by less than its catch-up time is run first.
+func (s *Scheduler) Run(ctx context.Context) {
+
+	var wg sync.WaitGroup
+	for _, job := range s.jobs {
+
+		job.beat()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer job.heartbeat.Store(0)
+			s.loop(ctx, job)
+		}()
+	}
+
+	wg.Wait()
+}
+
+// Heartbeat returns the oldest beat of the job loops, so a loop stuck in a run shows.
+// It's zero when Run is not running.
+func (s *Scheduler) Heartbeat() time.Time {
+
+	var oldest int64
+	for _, job := range s.jobs {
+		nano := job.heartbeat.Load()
+		if nano == 0 {
+			return time.Time{}
+		}
+		if oldest == 0 || nano < oldest {
+			oldest = nano
+		}
+	}
+
+	if oldest == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(0, oldest)
+}
+
+func (s *Scheduler) loop(ctx context.Context, job *job) {
+
+	if job.catchUp > 0 {
+		now := time.Now()
+		if missed := job.schedule.Next(now.Add(-job.catchUp)); !missed.IsZero() && !missed.After(now) {
+			s.runScheduled(ctx, job, missed, model.JobTriggerCatchUp)
+		}
+	}
+
+	for {
+		next := job.schedule.Next(time.Now())
+		if next.IsZero() {
+			log.Printf("job %s has no next run", job.name)
+		}
+
+		if !waitUntil(ctx, job, next) {
+			return
+		}
+
+		s.runScheduled(ctx, job, next, model.JobTriggerSchedule)
+	}
+}
+
+// waitUntil waits for at, forever when it's zero, beating every HeartbeatInterval. It's false when ctx is done first.
+func waitUntil(ctx context.Context, job *job, at time.Time) bool {
+
+	for {
+		job.beat()
+
+		wait := HeartbeatInterval
+		if !at.IsZero() {
+			until := time.Until(at)
+			if until <= 0 {
+				return true
+			}
+			wait = min(wait, until)
+		}
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(wait):
+		}
+	}
+}
+
+// runScheduled runs the job unless it's paused or it already ran for scheduledAt, like on the previous leader.
+func (s *Scheduler) runScheduled(ctx context.Context, job *job, scheduledAt time.Time, trigger string) {
+
+	state, err := s.store.FindJob(job.name)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		log.Printf("find job %s error %v", job.name, err)
+		return
+	}
+
+	if state.Paused {
+		log.Printf("Job %s is paused, skipping the run of %s", job.name, scheduledAt.Format(time.DateTime))
+		return
+	}
+
+	claimed, err := s.store.ClaimJob(job.name, scheduledAt)
+	if err != nil {
+		log.Printf("claim job %s error %v", job.name, err)
+		return
+	}
+
+	if claimed {
+		s.execute(ctx, job, scheduledAt, trigger)
+	}
+}
+
+// execute runs the job and keeps the run in the history.
+func (s *Scheduler) execute(ctx context.Context, job *job, scheduledAt time.Time, trigger string) error {
+
+	run := model.JobRun{
+		Name:        job.name,
+		Trigger:     trigger,
+		ScheduledAt: scheduledAt,
+		StartedAt:   time.Now(),
+	}
+
+	if err := s.store.SaveJobRun(&run); err != nil {
+		log.Printf("save job %s run error %v", job.name, err)
+	}
+
+	log.Printf("Running job %s (%s)", job.name, trigger)
+
+	err := job.run(ctx, scheduledAt)
+
+	finishedAt := time.Now()
+	run.FinishedAt = &finishedAt
+
+	result := "success"
+	if err != nil {
+		result = "error"
+		run.Error = err.Error()
+		log.Printf("job %s error %v", job.name, err)
+	}
+	metrics.JobRuns.WithLabelValues(job.name, result).Inc()
+
+	if err := s.store.SaveJobRun(&run); err != nil {
+		log.Printf("save job %s run error %v", job.name, err)
+	}
+
+	return err
+}
+
+// Trigger runs the job now on this instance, even when it's paused, without waiting for it to finish.
+func (s *Scheduler) Trigger(name string) error {
+
+	job := s.find(name)
+	if job == nil {
+		return ErrUnknownJob
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.shutdown {
+		return ErrShutdown
+	}
+
+	s.manual.Add(1)
+	go func() {
+		defer s.manual.Done()
+		s.execute(s.manualCtx, job, time.Now(), model.JobTriggerManual)
+	}()
+
+	return nil
+}
+
+// Shutdown rejects new manual runs and waits for the running ones, they are cancelled when ctx is done first.
+func (s *Scheduler) Shutdown(ctx context.Context) error {
+
+	s.mutex.Lock()
+	s.shutdown = true
+	s.mutex.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.manual.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		s.cancelManual()
+		return ctx.Err()
+	}
+}
+
+// SetPaused pauses or resumes the scheduled runs of the job, on every instance.
+func (s *Scheduler) SetPaused(name string, paused bool) error {
+
+	if s.find(name) == nil {
+		return ErrUnknownJob
+	}
+
+	return s.store.SetJobPaused(name, paused)
+}
+
+// Status is the state of a job for admins.
+type Status struct {
+	Name      string
+	Schedule  string
+	Paused    bool
+	LastRunAt *time.Time
+	NextRunAt time.Time
+	Runs      []model.JobRun
+}
+
+// Status returns the state of every job, in the order they were registered.
+func (s *Scheduler) Status() ([]Status, error) {
+
+	statuses := []Status{}
+	for _, job := range s.jobs {
+
+		state, err := s.store.FindJob(job.name)
+		if err != nil && !errors.Is(err, storage.ErrNotFound) {
+			return nil, err
+		}
+
+		runs, err := s.store.ListJobRuns(job.name, historySize)
+		if err != nil {
+			return nil, err
+		}
+
+		statuses = append(statuses, Status{
+			Name:      job.name,
+			Schedule:  fmt.Sprint(job.schedule),
+			Paused:    state.Paused,
+			LastRunAt: state.LastRunAt,
+			NextRunAt: job.schedule.Next(time.Now()),
+			Runs:      runs,
+		})
+	}
+
+	return statuses, nil
+}
+
+func (s *Scheduler) find(name string) *job {
+
+	for _, job := range s.jobs {
+		if job.name == name {
+			return job
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,87 @@
+package storage
+
+import (
+	model "luncher/handler/models"
+	"luncher/handler/utils"
+	"sync/atomic"
+	"time"
+)
+
+// menuKey is the only key of the meals cache, the menu is read and changed as a whole.
+const menuKey = "menu"
+
+// Cached serves the meals of a store from memory, they are read on every reserve list and rarely change.
+// Meals saved by other replicas are seen after the TTL.
+type Cached struct {
+	Store
+
+	meals *utils.Cache[string, []model.Meal]
+
+	// mealsSaved is set when SaveMeals runs in a transaction, the cache is cleared after it
+	mealsSaved atomic.Bool
+}
+
+func NewCached(store Store, ttl time.Duration) *Cached {
+	return &Cached{
+		Store: store,
+		meals: utils.NewCache[string, []model.Meal](utils.CacheOptions{MaxSize: 1, TTL: ttl}),
+	}
+}
+
+func (s *Cached) ListMeals() ([]model.Meal, error) {
+
+	meals, err := s.meals.GetOrLoad(menuKey, s.Store.ListMeals)
+	if err != nil {
+		return nil, err
+	}
+
+	// callers may change the returned meals
+	return append([]model.Meal{}, meals...), nil
+}
+
+func (s *Cached) FindMeal(id uint) (model.Meal, error) {
+
+	meals, err := s.meals.GetOrLoad(menuKey, s.Store.ListMeals)
+	if err != nil {
+		return model.Meal{}, err
+	}
+
+	for _, meal := range meals {
+		if meal.ID == id {
+			return meal, nil
+		}
+	}
+
+	return model.Meal{}, ErrNotFound
+}
+
+func (s *Cached) SaveMeals(meals ...model.Meal) error {
+
+	err := s.Store.SaveMeals(meals...)
+
+	s.meals.Delete(menuKey)
+	s.mealsSaved.Store(true)
+
+	return err
+}
+
+// Transaction runs fn with the cache in front of the transaction, the meals are dropped from it after a transaction saving them.
+func (s *Cached) Transaction(fn func(store Store) error) error {
+
+	var cached *Cached
+	err := s.Store.Transaction(func(store Store) error {
+		cached = &Cached{Store: store, meals: s.meals}
+		return fn(cached)
+	})
+
+	if cached != nil && cached.mealsSaved.Load() {
+		s.meals.Delete(menuKey)
+	}
+
+	return err
+}
+
+// MealCacheStats returns the hits and misses of the meals cache.
+func (s *Cached) MealCacheStats() utils.CacheStats {
+	return s.meals.Stats()
+}
@@ -0,0 +1,246 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	model "luncher/handler/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// users having the meal on a date, by their reserve or else by always lunch and dinner
+const (
+	lunchUsersQuery  = "(always_lunch = ? AND NOT EXISTS(SELECT user_id FROM reserves WHERE reserves.user_id = users.id and date = ?)) OR id IN (SELECT user_id FROM reserves WHERE date = ? AND has_lunch = ?)"
+	dinnerUsersQuery = "(always_dinner = ? AND NOT EXISTS(SELECT user_id FROM reserves WHERE reserves.user_id = users.id and date = ?)) OR id IN (SELECT user_id FROM reserves WHERE date = ? AND has_dinner = ?)"
+)
+
+// Gorm is the postgres store.
+type Gorm struct {
+	db *gorm.DB
+}
+
+func NewGorm(db *gorm.DB) *Gorm {
+	return &Gorm{db: db}
+}
+
+func (s *Gorm) FindUser(telegramID int64) (model.User, error) {
+
+	var user model.User
+	err := s.db.Where("telegram_id = ?", telegramID).First(&user).Error
+
+	return user, notFound(err)
+}
+
+func (s *Gorm) FindUserByCalendarToken(token string) (model.User, error) {
+
+	var user model.User
+	err := s.db.Where("calendar_token = ?", token).First(&user).Error
+
+	return user, notFound(err)
+}
+
+func (s *Gorm) ListUsers() ([]model.User, error) {
+
+	var users []model.User
+	err := s.db.Order("id").Find(&users).Error
+
+	return users, err
+}
+
+func (s *Gorm) SaveUser(user *model.User) error {
+	return s.db.Save(user).Error
+}
+
+func (s *Gorm) FindReserve(userID uint, date time.Time) (model.Reserve, error) {
+
+	var reserve model.Reserve
+	err := s.db.Where("date = ?", date).Where("user_id = ?", userID).First(&reserve).Error
+
+	return reserve, notFound(err)
+}
+
+func (s *Gorm) ListReserves(userID uint, from time.Time, to time.Time) ([]model.Reserve, error) {
+
+	var reserves []model.Reserve
+	err := s.db.Where("user_id = ? AND date >= ? AND date <= ?", userID, from, to).Order("date").Find(&reserves).Error
+
+	return reserves, err
+}
+
+func (s *Gorm) SaveReserve(reserve *model.Reserve) error {
+	return s.db.Save(reserve).Error
+}
+
+// LockReserves locks the row of the user, reserves not created yet are covered too.
+func (s *Gorm) LockReserves(userID uint) error {
+	return s.db.Exec("SELECT id FROM users WHERE id = ? FOR UPDATE", userID).Error
+}
+
+func (s *Gorm) LunchUsers(date time.Time) ([]model.User, error) {
+	return s.mealUsers(lunchUsersQuery, date)
+}
+
+func (s *Gorm) DinnerUsers(date time.Time) ([]model.User, error) {
+	return s.mealUsers(dinnerUsersQuery, date)
+}
+
+func (s *Gorm) mealUsers(query string, date time.Time) ([]model.User, error) {
+
+	dateString := date.Format("2006-01-02")
+
+	var users []model.User
+	err := s.db.Where(query, true, dateString, dateString, true).Order("name").Find(&users).Error
+
+	return users, err
+}
+
+func (s *Gorm) ListMeals() ([]model.Meal, error) {
+
+	var meals []model.Meal
+	err := s.db.Order("id").Find(&meals).Error
+
+	return meals, err
+}
+
+func (s *Gorm) FindMeal(id uint) (model.Meal, error) {
+
+	var meal model.Meal
+	err := s.db.First(&meal, id).Error
+
+	return meal, notFound(err)
+}
+
+func (s *Gorm) SaveMeals(meals ...model.Meal) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		for _, meal := range meals {
+			if err := tx.Save(&meal).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *Gorm) FindConversation(telegramID int64) (model.Conversation, error) {
+
+	var conversation model.Conversation
+	err := s.db.Where("telegram_id = ?", telegramID).First(&conversation).Error
+
+	return conversation, notFound(err)
+}
+
+func (s *Gorm) SaveConversation(conversation *model.Conversation) error {
+	return s.db.Save(conversation).Error
+}
+
+func (s *Gorm) DeleteConversation(telegramID int64) (bool, error) {
+
+	result := s.db.Where("telegram_id = ?", telegramID).Delete(&model.Conversation{})
+
+	return result.RowsAffected > 0, result.Error
+}
+
+func (s *Gorm) ExpireConversations(now time.Time) ([]model.Conversation, error) {
+
+	// deleting with returning hands each expired conversation to one replica only
+	var conversations []model.Conversation
+	err := s.db.Clauses(clause.Returning{}).Where("expires_at <= ?", now).Delete(&conversations).Error
+
+	return conversations, err
+}
+
+func (s *Gorm) FindJob(name string) (model.Job, error) {
+
+	var job model.Job
+	err := s.db.Where("name = ?", name).First(&job).Error
+
+	return job, notFound(err)
+}
+
+func (s *Gorm) ClaimJob(name string, due time.Time) (bool, error) {
+
+	now := time.Now()
+
+	// one statement, so a claim can't be lost between two instances
+	result := s.db.Exec(`INSERT INTO jobs (name, last_run_at, updated_at) VALUES (?, ?, ?)
+		ON CONFLICT (name) DO UPDATE SET last_run_at = excluded.last_run_at, updated_at = excluded.updated_at
+		WHERE jobs.last_run_at IS NULL OR jobs.last_run_at < ?`, name, now, now, due)
+
+	return result.RowsAffected > 0, result.Error
+}
+
+func (s *Gorm) SetJobPaused(name string, paused bool) error {
+	return s.db.Exec(`INSERT INTO jobs (name, paused, updated_at) VALUES (?, ?, ?)
+		ON CONFLICT (name) DO UPDATE SET paused = excluded.paused, updated_at = excluded.updated_at`, name, paused, time.Now()).Error
+}
+
+func (s *Gorm) SaveJobRun(run *model.JobRun) error {
+	return s.db.Save(run).Error
+}
+
+func (s *Gorm) ListJobRuns(name string, limit int) ([]model.JobRun, error) {
+
+	var runs []model.JobRun
+	err := s.db.Where("name = ?", name).Order("started_at DESC").Limit(limit).Find(&runs).Error
+
+	return runs, err
+}
+
+func (s *Gorm) EnqueueMessages(messages []model.OutboxMessage) error {
+	return s.db.CreateInBatches(messages, 500).Error
+}
+
+func (s *Gorm) DueMessages(now time.Time, limit int) ([]model.OutboxMessage, error) {
+
+	var messages []model.OutboxMessage
+	err := s.db.Where("status = ? AND next_attempt_at <= ?", model.OutboxPending, now).Order("id").Limit(limit).Find(&messages).Error
+
+	return messages, err
+}
+
+func (s *Gorm) SaveOutboxMessage(message *model.OutboxMessage) error {
+	return s.db.Save(message).Error
+}
+
+func (s *Gorm) CreateWebhookDeliveries(deliveries []model.WebhookDelivery) error {
+	return s.db.CreateInBatches(deliveries, 500).Error
+}
+
+func (s *Gorm) DueWebhookDeliveries(now time.Time, limit int) ([]model.WebhookDelivery, error) {
+
+	var deliveries []model.WebhookDelivery
+	err := s.db.Where("status = ? AND next_attempt_at <= ?", model.WebhookPending, now).Order("id").Limit(limit).Find(&deliveries).Error
+
+	return deliveries, err
+}
+
+func (s *Gorm) SaveWebhookDelivery(delivery *model.WebhookDelivery) error {
+	return s.db.Save(delivery).Error
+}
+
+func (s *Gorm) Transaction(fn func(store Store) error) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		return fn(NewGorm(tx))
+	})
+}
+
+func (s *Gorm) Ping(ctx context.Context) error {
+
+	sqlDB, err := s.db.DB()
+	if err != nil {
+		return err
+	}
+
+	return sqlDB.PingContext(ctx)
+}
+
+func notFound(err error) error {
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrNotFound
+	}
+
+	return err
+}
@@ -0,0 +1,507 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	model "luncher/handler/models"
+	"maps"
+	"sort"
+	"sync"
+	"time"
+)
+
+var ErrDuplicate = errors.New("duplicate record")
+
+// Memory keeps everything in process memory, for demo mode and tests.
+type Memory struct {
+	mutex sync.RWMutex
+
+	users    map[uint]model.User
+	reserves map[uint]model.Reserve
+	meals    map[uint]model.Meal
+
+	conversations map[int64]model.Conversation
+	jobs          map[string]model.Job
+	jobRuns       map[uint]model.JobRun
+	outbox        map[uint]model.OutboxMessage
+	deliveries    map[uint]model.WebhookDelivery
+
+	lastUserID     uint
+	lastReserveID  uint
+	lastJobRunID   uint
+	lastOutboxID   uint
+	lastDeliveryID uint
+
+	// transaction makes transactions run one at a time
+	transaction sync.Mutex
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		users:    map[uint]model.User{},
+		reserves: map[uint]model.Reserve{},
+		meals:    map[uint]model.Meal{},
+
+		conversations: map[int64]model.Conversation{},
+		jobs:          map[string]model.Job{},
+		jobRuns:       map[uint]model.JobRun{},
+		outbox:        map[uint]model.OutboxMessage{},
+		deliveries:    map[uint]model.WebhookDelivery{},
+	}
+}
+
+func (s *Memory) FindUser(telegramID int64) (model.User, error) {
+	return s.findUser(func(user model.User) bool { return user.TelegramID == telegramID })
+}
+
+func (s *Memory) FindUserByCalendarToken(token string) (model.User, error) {
+	return s.findUser(func(user model.User) bool { return user.CalendarToken != nil && *user.CalendarToken == token })
+}
+
+func (s *Memory) findUser(match func(user model.User) bool) (model.User, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	for _, user := range s.users {
+		if match(user) {
+			return user, nil
+		}
+	}
+
+	return model.User{}, ErrNotFound
+}
+
+func (s *Memory) ListUsers() ([]model.User, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	users := []model.User{}
+	for _, user := range s.users {
+		users = append(users, user)
+	}
+
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+
+	return users, nil
+}
+
+func (s *Memory) SaveUser(user *model.User) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, other := range s.users {
+		if other.ID != user.ID && other.TelegramID == user.TelegramID {
+			return ErrDuplicate
+		}
+	}
+
+	now := time.Now()
+	if user.ID == 0 {
+		s.lastUserID++
+		user.ID = s.lastUserID
+		user.CreatedAt = now
+	}
+	user.UpdatedAt = now
+
+	saved := *user
+	saved.Reserves = nil
+	s.users[user.ID] = saved
+
+	return nil
+}
+
+func (s *Memory) FindReserve(userID uint, date time.Time) (model.Reserve, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if reserve, found := s.findReserve(userID, date); found {
+		return reserve, nil
+	}
+
+	return model.Reserve{}, ErrNotFound
+}
+
+func (s *Memory) findReserve(userID uint, date time.Time) (model.Reserve, bool) {
+
+	for _, reserve := range s.reserves {
+		if reserve.UserID == userID && sameDay(reserve.Date, date) {
+			return reserve, true
+		}
+	}
+
+	return model.Reserve{}, false
+}
+
+func (s *Memory) ListReserves(userID uint, from time.Time, to time.Time) ([]model.Reserve, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	reserves := []model.Reserve{}
+	for _, reserve := range s.reserves {
+		if reserve.UserID == userID && !reserve.Date.Before(from) && !reserve.Date.After(to) {
+			reserves = append(reserves, reserve)
+		}
+	}
+
+	sort.Slice(reserves, func(i, j int) bool { return reserves[i].Date.Before(reserves[j].Date) })
+
+	return reserves, nil
+}
+
+func (s *Memory) SaveReserve(reserve *model.Reserve) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if other, found := s.findReserve(reserve.UserID, reserve.Date); found && other.ID != reserve.ID {
+		return ErrDuplicate
+	}
+
+	now := time.Now()
+	if reserve.ID == 0 {
+		s.lastReserveID++
+		reserve.ID = s.lastReserveID
+		reserve.CreatedAt = now
+	}
+	reserve.UpdatedAt = now
+
+	saved := *reserve
+	saved.User = model.User{}
+	s.reserves[reserve.ID] = saved
+
+	return nil
+}
+
+// LockReserves has nothing to do, transactions run one at a time.
+func (s *Memory) LockReserves(userID uint) error {
+	return nil
+}
+
+func (s *Memory) LunchUsers(date time.Time) ([]model.User, error) {
+	return s.mealUsers(date, func(user model.User) bool { return user.AlwaysLunch }, func(reserve model.Reserve) bool { return reserve.HasLunch })
+}
+
+func (s *Memory) DinnerUsers(date time.Time) ([]model.User, error) {
+	return s.mealUsers(date, func(user model.User) bool { return user.AlwaysDinner }, func(reserve model.Reserve) bool { return reserve.HasDinner })
+}
+
+func (s *Memory) mealUsers(date time.Time, always func(user model.User) bool, has func(reserve model.Reserve) bool) ([]model.User, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	users := []model.User{}
+	for _, user := range s.users {
+
+		hasMeal := always(user)
+		if reserve, found := s.findReserve(user.ID, date); found {
+			hasMeal = has(reserve)
+		}
+
+		if hasMeal {
+			users = append(users, user)
+		}
+	}
+
+	sort.Slice(users, func(i, j int) bool { return users[i].Name < users[j].Name })
+
+	return users, nil
+}
+
+func (s *Memory) ListMeals() ([]model.Meal, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	meals := []model.Meal{}
+	for _, meal := range s.meals {
+		meals = append(meals, meal)
+	}
+
+	sort.Slice(meals, func(i, j int) bool { return meals[i].ID < meals[j].ID })
+
+	return meals, nil
+}
+
+func (s *Memory) FindMeal(id uint) (model.Meal, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	meal, found := s.meals[id]
+	if !found {
+		return meal, ErrNotFound
+	}
+
+	return meal, nil
+}
+
+func (s *Memory) SaveMeals(meals ...model.Meal) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, meal := range meals {
+		s.meals[meal.ID] = meal
+	}
+
+	return nil
+}
+
+func (s *Memory) FindConversation(telegramID int64) (model.Conversation, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	conversation, found := s.conversations[telegramID]
+	if !found {
+		return conversation, ErrNotFound
+	}
+
+	conversation.Data = maps.Clone(conversation.Data)
+
+	return conversation, nil
+}
+
+func (s *Memory) SaveConversation(conversation *model.Conversation) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	conversation.UpdatedAt = time.Now()
+
+	saved := *conversation
+	saved.Data = maps.Clone(conversation.Data)
+	s.conversations[conversation.TelegramID] = saved
+
+	return nil
+}
+
+func (s *Memory) DeleteConversation(telegramID int64) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	_, found := s.conversations[telegramID]
+	delete(s.conversations, telegramID)
+
+	return found, nil
+}
+
+func (s *Memory) ExpireConversations(now time.Time) ([]model.Conversation, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	expired := []model.Conversation{}
+	for telegramID, conversation := range s.conversations {
+		if !conversation.ExpiresAt.After(now) {
+			expired = append(expired, conversation)
+			delete(s.conversations, telegramID)
+		}
+	}
+
+	return expired, nil
+}
+
+func (s *Memory) FindJob(name string) (model.Job, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	job, found := s.jobs[name]
+	if !found {
+		return job, ErrNotFound
+	}
+
+	return job, nil
+}
+
+func (s *Memory) ClaimJob(name string, due time.Time) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	job := s.jobs[name]
+	if job.LastRunAt != nil && !job.LastRunAt.Before(due) {
+		return false, nil
+	}
+
+	now := time.Now()
+	job.Name = name
+	job.LastRunAt = &now
+	job.UpdatedAt = now
+	s.jobs[name] = job
+
+	return true, nil
+}
+
+func (s *Memory) SetJobPaused(name string, paused bool) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	job := s.jobs[name]
+	job.Name = name
+	job.Paused = paused
+	job.UpdatedAt = time.Now()
+	s.jobs[name] = job
+
+	return nil
+}
+
+func (s *Memory) SaveJobRun(run *model.JobRun) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if run.ID == 0 {
+		s.lastJobRunID++
+		run.ID = s.lastJobRunID
+	}
+	s.jobRuns[run.ID] = *run
+
+	return nil
+}
+
+func (s *Memory) ListJobRuns(name string, limit int) ([]model.JobRun, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	runs := []model.JobRun{}
+	for _, run := range s.jobRuns {
+		if run.Name == name {
+			runs = append(runs, run)
+		}
+	}
+
+	sort.Slice(runs, func(i, j int) bool { return runs[i].StartedAt.After(runs[j].StartedAt) })
+
+	if len(runs) > limit {
+		runs = runs[:limit]
+	}
+
+	return runs, nil
+}
+
+func (s *Memory) EnqueueMessages(messages []model.OutboxMessage) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	for i := range messages {
+		s.lastOutboxID++
+		messages[i].ID = s.lastOutboxID
+		messages[i].CreatedAt = now
+		s.outbox[messages[i].ID] = messages[i]
+	}
+
+	return nil
+}
+
+func (s *Memory) DueMessages(now time.Time, limit int) ([]model.OutboxMessage, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	messages := []model.OutboxMessage{}
+	for _, message := range s.outbox {
+		if message.Status == model.OutboxPending && !message.NextAttemptAt.After(now) {
+			messages = append(messages, message)
+		}
+	}
+
+	sort.Slice(messages, func(i, j int) bool { return messages[i].ID < messages[j].ID })
+
+	if len(messages) > limit {
+		messages = messages[:limit]
+	}
+
+	return messages, nil
+}
+
+func (s *Memory) SaveOutboxMessage(message *model.OutboxMessage) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if message.ID == 0 {
+		s.lastOutboxID++
+		message.ID = s.lastOutboxID
+		message.CreatedAt = time.Now()
+	}
+	s.outbox[message.ID] = *message
+
+	return nil
+}
+
+func (s *Memory) CreateWebhookDeliveries(deliveries []model.WebhookDelivery) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	for i := range deliveries {
+		s.lastDeliveryID++
+		deliveries[i].ID = s.lastDeliveryID
+		deliveries[i].CreatedAt = now
+		deliveries[i].UpdatedAt = now
+		s.deliveries[deliveries[i].ID] = deliveries[i]
+	}
+
+	return nil
+}
+
+func (s *Memory) DueWebhookDeliveries(now time.Time, limit int) ([]model.WebhookDelivery, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	deliveries := []model.WebhookDelivery{}
+	for _, delivery := range s.deliveries {
+		if delivery.Status == model.WebhookPending && !delivery.NextAttemptAt.After(now) {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+
+	sort.Slice(deliveries, func(i, j int) bool { return deliveries[i].ID < deliveries[j].ID })
+
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+
+	return deliveries, nil
+}
+
+func (s *Memory) SaveWebhookDelivery(delivery *model.WebhookDelivery) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	if delivery.ID == 0 {
+		s.lastDeliveryID++
+		delivery.ID = s.lastDeliveryID
+		delivery.CreatedAt = now
+	}
+	delivery.UpdatedAt = now
+	s.deliveries[delivery.ID] = *delivery
+
+	return nil
+}
+
+// Transaction restores the previous data when fn fails.
+// Changes made meanwhile outside the transaction are lost too, it's enough for demo mode and tests.
+func (s *Memory) Transaction(fn func(store Store) error) error {
+	s.transaction.Lock()
+	defer s.transaction.Unlock()
+
+	s.mutex.RLock()
+	users, reserves, meals := maps.Clone(s.users), maps.Clone(s.reserves), maps.Clone(s.meals)
+	conversations, jobs, jobRuns, outbox := maps.Clone(s.conversations), maps.Clone(s.jobs), maps.Clone(s.jobRuns), maps.Clone(s.outbox)
+	deliveries, lastDeliveryID := maps.Clone(s.deliveries), s.lastDeliveryID
+	lastUserID, lastReserveID, lastJobRunID, lastOutboxID := s.lastUserID, s.lastReserveID, s.lastJobRunID, s.lastOutboxID
+	s.mutex.RUnlock()
+
+	err := fn(s)
+	if err != nil {
+		s.mutex.Lock()
+		s.users, s.reserves, s.meals = users, reserves, meals
+		s.conversations, s.jobs, s.jobRuns, s.outbox = conversations, jobs, jobRuns, outbox
+		s.lastUserID, s.lastReserveID, s.lastJobRunID, s.lastOutboxID = lastUserID, lastReserveID, lastJobRunID, lastOutboxID
+		s.deliveries, s.lastDeliveryID = deliveries, lastDeliveryID
+		s.mutex.Unlock()
+	}
+
+	return err
+}
+
+func (s *Memory) Ping(ctx context.Context) error {
+	return nil
+}
+
+func sameDay(a time.Time, b time.Time) bool {
+	return a.Format("2006-01-02") == b.Format("2006-01-02")
+}
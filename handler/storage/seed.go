@@ -0,0 +1,70 @@
+package storage
+
+import (
+	model "luncher/handler/models"
+	"time"
+)
+
+// demoDishes are the lunch and dinner of each slot of the demo menu rotation.
+var demoDishes = [model.MenuSlots][2]string{
+	{"چلو کباب", "سوپ جو"},
+	{"قورمه سبزی", "کوکو سبزی"},
+	{"زرشک پلو با مرغ", "عدسی"},
+	{"قیمه", "ماکارونی"},
+	{"لوبیا پلو", "کتلت"},
+	{"کشک بادمجان", "املت"},
+	{"ماهی و سبزی پلو", "آش رشته"},
+	{"خورشت بادمجان", "کوکو سیب زمینی"},
+	{"باقالی پلو", "سالاد الویه"},
+	{"عدس پلو", "سوپ مرغ"},
+	{"جوجه کباب", "کشک بادمجان"},
+	{"استامبولی", "شامی"},
+	{"آبگوشت", "حلیم"},
+	{"ته چین", "کتلت"},
+}
+
+// Seed fills the store with a demo menu and a few users with reserves.
+func Seed(store Store) error {
+
+	meals := []model.Meal{}
+	for i, dishes := range demoDishes {
+		lunch, dinner := dishes[0], dishes[1]
+		meals = append(meals, model.Meal{ID: uint(i + 1), Lunch: &lunch, Dinner: &dinner})
+	}
+
+	if err := store.SaveMeals(meals...); err != nil {
+		return err
+	}
+
+	users := []model.User{
+		{Name: "Sara", Username: "demo_sara", TelegramID: 1001, AlwaysLunch: true},
+		{Name: "Reza", Username: "demo_reza", TelegramID: 1002, AlwaysLunch: true, AlwaysDinner: true},
+		{Name: "Mina", Username: "demo_mina", TelegramID: 1003},
+	}
+
+	today, _ := time.Parse("2006-01-02", time.Now().Format("2006-01-02"))
+
+	for i := range users {
+
+		if err := store.SaveUser(&users[i]); err != nil {
+			return err
+		}
+
+		// a few explicit reserves next to the always lunch and dinner fallback
+		for day := i; day < 7; day += 2 {
+
+			reserve := model.Reserve{
+				Date:      today.AddDate(0, 0, day),
+				UserID:    users[i].ID,
+				HasLunch:  day%3 != 0,
+				HasDinner: day%4 == 0,
+			}
+
+			if err := store.SaveReserve(&reserve); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,112 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	model "luncher/handler/models"
+	"time"
+)
+
+var ErrNotFound = errors.New("record not found")
+
+type Users interface {
+	FindUser(telegramID int64) (model.User, error)
+	FindUserByCalendarToken(token string) (model.User, error)
+	ListUsers() ([]model.User, error)
+
+	// SaveUser creates the user when its ID is zero, or updates it.
+	SaveUser(user *model.User) error
+}
+
+type Reserves interface {
+	FindReserve(userID uint, date time.Time) (model.Reserve, error)
+
+	// ListReserves returns the reserves of the user from from to to, both included.
+	ListReserves(userID uint, from time.Time, to time.Time) ([]model.Reserve, error)
+
+	// SaveReserve creates the reserve when its ID is zero, or updates it.
+	SaveReserve(reserve *model.Reserve) error
+
+	// LockReserves makes other transactions changing the reserves of the user wait until this one ends.
+	// It only locks inside Transaction, a reserve is read and saved by one writer at a time then.
+	LockReserves(userID uint) error
+
+	// LunchUsers returns the users having lunch on the date, by their reserve or else by always lunch, ordered by name.
+	LunchUsers(date time.Time) ([]model.User, error)
+
+	// DinnerUsers returns the users having dinner on the date, by their reserve or else by always dinner, ordered by name.
+	DinnerUsers(date time.Time) ([]model.User, error)
+}
+
+type Meals interface {
+	ListMeals() ([]model.Meal, error)
+	FindMeal(id uint) (model.Meal, error)
+
+	// SaveMeals creates or replaces the menu slots of the meals.
+	SaveMeals(meals ...model.Meal) error
+}
+
+type Conversations interface {
+	FindConversation(telegramID int64) (model.Conversation, error)
+
+	// SaveConversation creates or replaces the conversation of the user.
+	SaveConversation(conversation *model.Conversation) error
+
+	// DeleteConversation deletes the conversation of the user and reports whether there was one.
+	DeleteConversation(telegramID int64) (bool, error)
+
+	// ExpireConversations deletes the conversations expired at now and returns them.
+	ExpireConversations(now time.Time) ([]model.Conversation, error)
+}
+
+type Jobs interface {
+	// FindJob returns the state of the job, a job never run nor paused is not found.
+	FindJob(name string) (model.Job, error)
+
+	// ClaimJob records that the job runs now and reports whether it should, it shouldn't when it already ran since due.
+	ClaimJob(name string, due time.Time) (bool, error)
+
+	SetJobPaused(name string, paused bool) error
+
+	// SaveJobRun creates the run when its ID is zero, or updates it.
+	SaveJobRun(run *model.JobRun) error
+
+	// ListJobRuns returns the last runs of the job, the latest first.
+	ListJobRuns(name string, limit int) ([]model.JobRun, error)
+}
+
+type Outbox interface {
+	// EnqueueMessages creates the messages, all of them or none.
+	EnqueueMessages(messages []model.OutboxMessage) error
+
+	// DueMessages returns the pending messages whose next attempt is due at now, the oldest first.
+	DueMessages(now time.Time, limit int) ([]model.OutboxMessage, error)
+
+	SaveOutboxMessage(message *model.OutboxMessage) error
+}
+
+type WebhookDeliveries interface {
+	// CreateWebhookDeliveries creates the deliveries, all of them or none.
+	CreateWebhookDeliveries(deliveries []model.WebhookDelivery) error
+
+	// DueWebhookDeliveries returns the pending deliveries whose next attempt is due at now, the oldest first.
+	DueWebhookDeliveries(now time.Time, limit int) ([]model.WebhookDelivery, error)
+
+	SaveWebhookDelivery(delivery *model.WebhookDelivery) error
+}
+
+// Store keeps the users, reserves, meals, conversations, jobs, outbox and webhook deliveries, in postgres or in memory.
+type Store interface {
+	Users
+	Reserves
+	Meals
+	Conversations
+	Jobs
+	Outbox
+	WebhookDeliveries
+
+	// Transaction runs fn with a store whose changes are all kept, or all dropped when fn returns an error.
+	Transaction(fn func(store Store) error) error
+
+	Ping(ctx context.Context) error
+}
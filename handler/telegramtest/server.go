@@ -0,0 +1,323 @@
+// Package telegramtest runs a fake telegram bot API on an httptest server, for end to end tests of the bot.
+//
+// Point the bot at Server.URL with the telegram.api_url config (TELEGRAM_API_URL) and Server.Token,
+// queue updates with SendText and PressButton, then check what the bot did with the recorded requests:
+//
+//	server := telegramtest.NewServer()
+//	defer server.Close()
+//
+//	server.PressButton(user, messageID, "v1:meal:2024-11-05:lunch")
+//	answers := server.WaitFor("answerCallbackQuery", 1, time.Second)
+package telegramtest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// Token is the bot token accepted by the server.
+const Token = "123456:test-token"
+
+// maxPollWait caps the long poll of getUpdates, so the bot notices shutdown quickly.
+const maxPollWait = 1 * time.Second
+
+// Request is one call to the bot API received by the server.
+type Request struct {
+	Method string
+	Params url.Values
+	Time   time.Time
+}
+
+// Server is a fake telegram bot API, it keeps the queued updates and records every request.
+type Server struct {
+	URL   string
+	Token string
+
+	// Bot is the user returned by getMe.
+	Bot tgbotapi.User
+
+	server *httptest.Server
+
+	mutex         sync.Mutex
+	requests      []Request
+	updates       []tgbotapi.Update
+	lastUpdateID  int
+	lastMessageID int
+	lastCallback  int
+
+	// chatErrors are returned by sendMessage to the chat, see FailChat
+	chatErrors map[int64][]chatError
+
+	// changed is closed and replaced when an update is queued or a request is recorded
+	changed chan struct{}
+}
+
+func NewServer() *Server {
+
+	s := &Server{
+		Token:      Token,
+		Bot:        tgbotapi.User{ID: 123456, FirstName: "Luncher", UserName: "luncher_test_bot"},
+		changed:    make(chan struct{}),
+		chatErrors: map[int64][]chatError{},
+	}
+
+	s.server = httptest.NewServer(http.HandlerFunc(s.handle))
+	s.URL = s.server.URL
+
+	return s
+}
+
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+// Requests returns the recorded requests of the method, or all of them when method is empty.
+func (s *Server) Requests(method string) []Request {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.filter(method)
+}
+
+// WaitFor waits until at least count requests of the method are recorded, or the timeout passes,
+// and returns the recorded requests of the method.
+func (s *Server) WaitFor(method string, count int, timeout time.Duration) []Request {
+
+	deadline := time.After(timeout)
+
+	for {
+		s.mutex.Lock()
+		requests := s.filter(method)
+		changed := s.changed
+		s.mutex.Unlock()
+
+		if len(requests) >= count {
+			return requests
+		}
+
+		select {
+		case <-changed:
+		case <-deadline:
+			return requests
+		}
+	}
+}
+
+// Reset drops the recorded requests and the queued updates.
+func (s *Server) Reset() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.requests = nil
+	s.updates = nil
+}
+
+func (s *Server) filter(method string) []Request {
+
+	requests := []Request{}
+	for _, request := range s.requests {
+		if method == "" || request.Method == method {
+			requests = append(requests, request)
+		}
+	}
+
+	return requests
+}
+
+// notify wakes up the waiting pollers and WaitFor calls, the mutex must be held.
+func (s *Server) notify() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// handle serves /bot<token>/<method>.
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+
+	token, method, found := strings.Cut(strings.TrimPrefix(r.URL.Path, "/bot"), "/")
+	if !found {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+
+	if token != s.Token {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest, "Bad Request: "+err.Error())
+		return
+	}
+
+	// getUpdates is recorded too, but only when it returns something, to keep the log readable
+	if method != "getUpdates" {
+		s.record(method, r.Form)
+	}
+
+	switch method {
+	case "getMe":
+		writeResult(w, s.Bot)
+	case "getUpdates":
+		s.getUpdates(w, r.Form)
+	case "sendMessage":
+		s.sendMessage(w, r.Form)
+	case "deleteMessage", "answerCallbackQuery", "setWebhook", "deleteWebhook":
+		writeResult(w, true)
+	default:
+		writeError(w, http.StatusNotFound, "Not Found: method not supported by telegramtest")
+	}
+}
+
+func (s *Server) record(method string, params url.Values) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.requests = append(s.requests, Request{Method: method, Params: params, Time: time.Now()})
+	s.notify()
+}
+
+// getUpdates returns the updates from offset, waiting for one up to the timeout like a long poll.
+func (s *Server) getUpdates(w http.ResponseWriter, params url.Values) {
+
+	offset, _ := strconv.Atoi(params.Get("offset"))
+	timeout, _ := strconv.Atoi(params.Get("timeout"))
+
+	wait := min(time.Duration(timeout)*time.Second, maxPollWait)
+	deadline := time.After(wait)
+
+	for {
+		s.mutex.Lock()
+
+		// confirmed updates are dropped, like telegram does
+		pending := []tgbotapi.Update{}
+		for _, update := range s.updates {
+			if update.UpdateID >= offset {
+				pending = append(pending, update)
+			}
+		}
+		s.updates = pending
+
+		changed := s.changed
+		if len(pending) > 0 {
+			s.requests = append(s.requests, Request{Method: "getUpdates", Params: params, Time: time.Now()})
+			s.notify()
+		}
+		s.mutex.Unlock()
+
+		if len(pending) > 0 {
+			writeResult(w, pending)
+			return
+		}
+
+		select {
+		case <-changed:
+		case <-deadline:
+			writeResult(w, []tgbotapi.Update{})
+			return
+		}
+	}
+}
+
+// chatError is an error response to sendMessage, times is how many times it's returned, 0 for always.
+type chatError struct {
+	code        int
+	description string
+	retryAfter  int
+	times       int
+}
+
+// FailChat makes the next times sendMessage calls to the chat fail with the error, or all of them when times is 0.
+// Like FailChat(id, 403, "Forbidden: bot was blocked by the user", 0, 0) or FailChat(id, 429, "Too Many Requests: retry after 1", 1, 1).
+func (s *Server) FailChat(chatID int64, code int, description string, retryAfter int, times int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.chatErrors[chatID] = append(s.chatErrors[chatID], chatError{code: code, description: description, retryAfter: retryAfter, times: times})
+}
+
+// chatError returns the next scripted error of the chat, the mutex must be held.
+func (s *Server) chatError(chatID int64) (chatError, bool) {
+
+	errs := s.chatErrors[chatID]
+	if len(errs) == 0 {
+		return chatError{}, false
+	}
+
+	failure := errs[0]
+	if failure.times > 0 {
+		errs[0].times--
+		if errs[0].times == 0 {
+			s.chatErrors[chatID] = errs[1:]
+		}
+	}
+
+	return failure, true
+}
+
+func (s *Server) sendMessage(w http.ResponseWriter, params url.Values) {
+
+	chatID, err := strconv.ParseInt(params.Get("chat_id"), 10, 64)
+	if err != nil || params.Get("text") == "" {
+		writeError(w, http.StatusBadRequest, "Bad Request: chat_id and text are required")
+		return
+	}
+
+	s.mutex.Lock()
+
+	if failure, found := s.chatError(chatID); found {
+		s.mutex.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(failure.code)
+		json.NewEncoder(w).Encode(response{
+			OK:          false,
+			ErrorCode:   failure.code,
+			Description: failure.description,
+			Parameters:  &parameters{RetryAfter: failure.retryAfter},
+		})
+		return
+	}
+
+	s.lastMessageID++
+	message := tgbotapi.Message{
+		MessageID: s.lastMessageID,
+		From:      &s.Bot,
+		Date:      int(time.Now().Unix()),
+		Chat:      &tgbotapi.Chat{ID: chatID, Type: "private"},
+		Text:      params.Get("text"),
+	}
+	s.mutex.Unlock()
+
+	writeResult(w, message)
+}
+
+type response struct {
+	OK          bool        `json:"ok"`
+	Result      any         `json:"result,omitempty"`
+	ErrorCode   int         `json:"error_code,omitempty"`
+	Description string      `json:"description,omitempty"`
+	Parameters  *parameters `json:"parameters,omitempty"`
+}
+
+type parameters struct {
+	RetryAfter int `json:"retry_after,omitempty"`
+}
+
+func writeResult(w http.ResponseWriter, result any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response{OK: true, Result: result})
+}
+
+func writeError(w http.ResponseWriter, code int, description string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(response{OK: false, ErrorCode: code, Description: description})
+}
@@ -0,0 +1,143 @@
+package telegramtest
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// NewUser returns a telegram user, its private chat has the same ID.
+func NewUser(id int, username string) tgbotapi.User {
+	return tgbotapi.User{ID: id, FirstName: username, UserName: username}
+}
+
+// SendText queues a private message of the user, like a command, and returns its update ID.
+func (s *Server) SendText(user tgbotapi.User, text string) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.lastMessageID++
+
+	message := &tgbotapi.Message{
+		MessageID: s.lastMessageID,
+		From:      &user,
+		Date:      int(time.Now().Unix()),
+		Chat:      privateChat(user),
+		Text:      text,
+	}
+
+	if strings.HasPrefix(text, "/") {
+		length := len(text)
+		if index := strings.IndexByte(text, ' '); index != -1 {
+			length = index
+		}
+		message.Entities = &[]tgbotapi.MessageEntity{{Type: "bot_command", Offset: 0, Length: length}}
+	}
+
+	return s.queue(tgbotapi.Update{Message: message})
+}
+
+// PressButton queues a press of the inline button with the data, on the message sent by the bot, and returns its update ID.
+// The callback query ID is the update ID as a string.
+func (s *Server) PressButton(user tgbotapi.User, messageID int, data string) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.lastCallback++
+
+	callback := &tgbotapi.CallbackQuery{
+		ID:   strconv.Itoa(s.lastCallback),
+		From: &user,
+		Message: &tgbotapi.Message{
+			MessageID: messageID,
+			From:      &s.Bot,
+			Chat:      privateChat(user),
+		},
+		Data: data,
+	}
+
+	return s.queue(tgbotapi.Update{CallbackQuery: callback})
+}
+
+// queue adds the update for the next getUpdates, the mutex must be held.
+func (s *Server) queue(update tgbotapi.Update) int {
+
+	s.lastUpdateID++
+	update.UpdateID = s.lastUpdateID
+
+	s.updates = append(s.updates, update)
+	s.notify()
+
+	return update.UpdateID
+}
+
+// SentMessage is a sendMessage request, with its reply markup decoded.
+type SentMessage struct {
+	ChatID    int64
+	Text      string
+	ParseMode string
+	Keyboard  [][]Button
+}
+
+type Button struct {
+	Text         string `json:"text"`
+	CallbackData string `json:"callback_data"`
+}
+
+// SentMessages returns the recorded sendMessage requests.
+func (s *Server) SentMessages() []SentMessage {
+
+	messages := []SentMessage{}
+	for _, request := range s.Requests("sendMessage") {
+
+		chatID, _ := strconv.ParseInt(request.Params.Get("chat_id"), 10, 64)
+
+		message := SentMessage{
+			ChatID:    chatID,
+			Text:      request.Params.Get("text"),
+			ParseMode: request.Params.Get("parse_mode"),
+		}
+
+		if markup := request.Params.Get("reply_markup"); markup != "" {
+			var keyboard struct {
+				InlineKeyboard [][]Button `json:"inline_keyboard"`
+			}
+			json.Unmarshal([]byte(markup), &keyboard)
+			message.Keyboard = keyboard.InlineKeyboard
+		}
+
+		messages = append(messages, message)
+	}
+
+	return messages
+}
+
+// CallbackAnswers returns the texts of the recorded answerCallbackQuery requests.
+func (s *Server) CallbackAnswers() []string {
+
+	answers := []string{}
+	for _, request := range s.Requests("answerCallbackQuery") {
+		answers = append(answers, request.Params.Get("text"))
+	}
+
+	return answers
+}
+
+// DeletedMessages returns the message IDs of the recorded deleteMessage requests.
+func (s *Server) DeletedMessages() []int {
+
+	deleted := []int{}
+	for _, request := range s.Requests("deleteMessage") {
+		messageID, _ := strconv.Atoi(request.Params.Get("message_id"))
+		deleted = append(deleted, messageID)
+	}
+
+	return deleted
+}
+
+func privateChat(user tgbotapi.User) *tgbotapi.Chat {
+	return &tgbotapi.Chat{ID: int64(user.ID), Type: "private", UserName: user.UserName, FirstName: user.FirstName}
+}
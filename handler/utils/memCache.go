@@ -1,72 +1,305 @@
 package utils
 
 import (
+	"container/list"
+	"context"
+	"errors"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
-type KeyValueTTL struct {
-	Key       string
-	Value     any
-	TTL       time.Duration // TTL as a duration
-	CreatedAt time.Time     // Time when the item was created
+// errLoadPanicked is returned to the callers sharing a load that panicked.
+var errLoadPanicked = errors.New("cache load panicked")
+
+type CacheOptions struct {
+	// MaxSize is the max number of items, the least recently used one is evicted past it.
+	MaxSize int
+
+	// TTL is how long an item lives, used by Set and GetOrLoad.
+	TTL time.Duration
+
+	// Sliding renews the TTL of an item on every hit, instead of counting it from when it was set.
+	Sliding bool
+
+	// CleanupInterval is how often Cleanup removes expired items.
+	CleanupInterval time.Duration
+}
+
+// CacheStats counts the cache lookups since it was created.
+type CacheStats struct {
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`
+	Evictions uint64 `json:"evictions"`
+	Size      int    `json:"size"`
 }
 
-type Store struct {
-	data  map[string]KeyValueTTL
-	mutex sync.RWMutex
-} 
+type cacheItem[K comparable, V any] struct {
+	key       K
+	value     V
+	ttl       time.Duration
+	expiresAt time.Time
+}
+
+// cacheLoad is a running load of GetOrLoad, shared by the misses of its key.
+type cacheLoad[V any] struct {
+	done       chan struct{}
+	value      V
+	err        error
+	generation uint64
+}
+
+// Cache is a typed in memory cache bounded by MaxSize, with LRU eviction and TTL.
+type Cache[K comparable, V any] struct {
+	options CacheOptions
+
+	mutex sync.Mutex
+	items map[K]*list.Element
+
+	// order has the most recently used item first
+	order *list.List
 
-func MemCache() *Store {
-	return &Store{
-		data: make(map[string]KeyValueTTL),
+	loads map[K]*cacheLoad[V]
+
+	// generation changes on Delete and Clear, a load started before isn't set
+	generation uint64
+
+	hits      atomic.Uint64
+	misses    atomic.Uint64
+	evictions atomic.Uint64
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+func NewCache[K comparable, V any](options CacheOptions) *Cache[K, V] {
+
+	if options.MaxSize < 1 {
+		options.MaxSize = 1000
 	}
+
+	if options.TTL <= 0 {
+		options.TTL = 1 * time.Minute
+	}
+
+	if options.CleanupInterval <= 0 {
+		options.CleanupInterval = 1 * time.Minute
+	}
+
+	return &Cache[K, V]{
+		options: options,
+		items:   map[K]*list.Element{},
+		loads:   map[K]*cacheLoad[V]{},
+		order:   list.New(),
+		stop:    make(chan struct{}),
+	}
+}
+
+// Set adds or replaces the value of key with the TTL of the cache.
+func (c *Cache[K, V]) Set(key K, value V) {
+	c.SetWithTTL(key, value, c.options.TTL)
+}
+
+// SetWithTTL adds or replaces the value of key with the given TTL.
+func (c *Cache[K, V]) SetWithTTL(key K, value V, ttl time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.set(key, value, ttl)
 }
 
-// Set adds a key-value pair with TTL as a duration.
-func (s *Store) Set(key string, value any, ttl time.Duration) {
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
+// set adds or replaces the value of key, the mutex must be held.
+func (c *Cache[K, V]) set(key K, value V, ttl time.Duration) {
 
-	s.data[key] = KeyValueTTL{
-		Key:       key,
-		Value:     value,
-		TTL:       ttl,
-		CreatedAt: time.Now(),
+	item := &cacheItem[K, V]{key: key, value: value, ttl: ttl, expiresAt: time.Now().Add(ttl)}
+
+	if element, exists := c.items[key]; exists {
+		element.Value = item
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.items[key] = c.order.PushFront(item)
+
+	for c.order.Len() > c.options.MaxSize {
+		c.remove(c.order.Back())
+		c.evictions.Add(1)
 	}
 }
 
-// Get retrieves a value if it exists and hasn't expired.
-func (s *Store) Get(key string) (any, bool) {
-	s.mutex.RLock()
-	defer s.mutex.RUnlock()
+// Get returns the value of key if it exists and hasn't expired.
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	var value V
 
-	item, exists := s.data[key]
-	if !exists || time.Since(item.CreatedAt) > item.TTL {
-		return nil, false
+	element, exists := c.items[key]
+	if !exists {
+		c.misses.Add(1)
+		return value, false
 	}
-	return item.Value, true
+
+	item := element.Value.(*cacheItem[K, V])
+
+	now := time.Now()
+	if !now.Before(item.expiresAt) {
+		c.remove(element)
+		c.misses.Add(1)
+		return value, false
+	}
+
+	if c.options.Sliding {
+		item.expiresAt = now.Add(item.ttl)
+	}
+	c.order.MoveToFront(element)
+	c.hits.Add(1)
+
+	return item.value, true
 }
 
-// Delete removes a key-value pair.
-func (s *Store) Delete(key string) {
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
-	delete(s.data, key)
+// GetOrLoad returns the value of key, or loads and sets it on a miss.
+// Concurrent misses of the same key share one load, a failed load isn't cached.
+// A load overlapping a Delete or Clear isn't cached either, it may have read what they were called for.
+func (c *Cache[K, V]) GetOrLoad(key K, load func() (V, error)) (V, error) {
+
+	if value, found := c.Get(key); found {
+		return value, nil
+	}
+
+	c.mutex.Lock()
+
+	// another load may have finished since the miss
+	if value, found := c.peek(key); found {
+		c.mutex.Unlock()
+		return value, nil
+	}
+
+	// a load started before a Delete or Clear isn't shared, a new one is started
+	if pending, exists := c.loads[key]; exists && pending.generation == c.generation {
+		c.mutex.Unlock()
+		<-pending.done
+		return pending.value, pending.err
+	}
+
+	pending := &cacheLoad[V]{done: make(chan struct{}), err: errLoadPanicked, generation: c.generation}
+	c.loads[key] = pending
+	c.mutex.Unlock()
+
+	defer func() {
+		c.mutex.Lock()
+		if c.loads[key] == pending {
+			delete(c.loads, key)
+		}
+		if pending.err == nil && pending.generation == c.generation {
+			c.set(key, pending.value, c.options.TTL)
+		}
+		c.mutex.Unlock()
+
+		close(pending.done)
+	}()
+
+	pending.value, pending.err = load()
+
+	return pending.value, pending.err
+}
+
+// peek returns the value of key without counting a hit or a miss, the mutex must be held.
+func (c *Cache[K, V]) peek(key K) (V, bool) {
+
+	var value V
+
+	element, exists := c.items[key]
+	if !exists {
+		return value, false
+	}
+
+	item := element.Value.(*cacheItem[K, V])
+	if !time.Now().Before(item.expiresAt) {
+		return value, false
+	}
+
+	return item.value, true
+}
+
+// Delete removes key.
+func (c *Cache[K, V]) Delete(key K) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.generation++
+
+	if element, exists := c.items[key]; exists {
+		c.remove(element)
+	}
 }
 
-// Cleanup removes expired keys periodically.
-func (s *Store) Cleanup() {
+// Clear removes every item.
+func (c *Cache[K, V]) Clear() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.generation++
+
+	c.items = map[K]*list.Element{}
+	c.order.Init()
+}
+
+// Cleanup removes expired items every CleanupInterval, until ctx is done or Stop is called.
+func (c *Cache[K, V]) Cleanup(ctx context.Context) {
+
+	ticker := time.NewTicker(c.options.CleanupInterval)
+	defer ticker.Stop()
+
 	for {
-		time.Sleep(1 * time.Minute) // Adjust interval as needed
-		// now := time.Now()
-
-		s.mutex.Lock()
-		for key, item := range s.data {
-			if time.Since(item.CreatedAt) > item.TTL {
-				delete(s.data, key)
-			}
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.stop:
+			return
+		case <-ticker.C:
+		}
+
+		c.removeExpired()
+	}
+}
+
+// Stop stops Cleanup.
+func (c *Cache[K, V]) Stop() {
+	c.stopOnce.Do(func() { close(c.stop) })
+}
+
+func (c *Cache[K, V]) removeExpired() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := time.Now()
+	for _, element := range c.items {
+		if !now.Before(element.Value.(*cacheItem[K, V]).expiresAt) {
+			c.remove(element)
 		}
-		s.mutex.Unlock()
+	}
+}
+
+// remove drops the item of element, the mutex must be held.
+func (c *Cache[K, V]) remove(element *list.Element) {
+	c.order.Remove(element)
+	delete(c.items, element.Value.(*cacheItem[K, V]).key)
+}
+
+// Len returns the number of stored items, expired ones included until cleanup.
+func (c *Cache[K, V]) Len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.order.Len()
+}
+
+func (c *Cache[K, V]) Stats() CacheStats {
+	return CacheStats{
+		Hits:      c.hits.Load(),
+		Misses:    c.misses.Load(),
+		Evictions: c.evictions.Load(),
+		Size:      c.Len(),
 	}
 }
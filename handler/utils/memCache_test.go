@@ -0,0 +1,65 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGetOrLoadSkipsLoadOverlappingDelete(t *testing.T) {
+
+	cache := NewCache[string, string](CacheOptions{TTL: time.Minute})
+
+	started := make(chan struct{})
+	finish := make(chan struct{})
+	loaded := make(chan string)
+
+	go func() {
+		value, _ := cache.GetOrLoad("menu", func() (string, error) {
+			close(started)
+			<-finish
+			return "old menu", nil
+		})
+		loaded <- value
+	}()
+
+	// the menu is saved while it's being read
+	<-started
+	cache.Delete("menu")
+	close(finish)
+
+	if value := <-loaded; value != "old menu" {
+		t.Fatalf("load returned %q", value)
+	}
+
+	value, err := cache.GetOrLoad("menu", func() (string, error) { return "new menu", nil })
+	if err != nil || value != "new menu" {
+		t.Fatalf("got %q, error %v, want the menu loaded after the delete", value, err)
+	}
+}
+
+func TestGetOrLoadKeysDontCollide(t *testing.T) {
+
+	cache := NewCache[any, string](CacheOptions{TTL: time.Minute})
+
+	started := make(chan struct{})
+	finish := make(chan struct{})
+	loaded := make(chan string)
+
+	go func() {
+		value, _ := cache.GetOrLoad(1, func() (string, error) {
+			close(started)
+			<-finish
+			return "number", nil
+		})
+		loaded <- value
+	}()
+
+	// both keys print as 1, the load of "1" must not wait for the one of 1
+	<-started
+	text, _ := cache.GetOrLoad("1", func() (string, error) { return "text", nil })
+	close(finish)
+
+	if number := <-loaded; number != "number" || text != "text" {
+		t.Fatalf("got %q and %q", number, text)
+	}
+}
@@ -2,39 +2,78 @@ package utils
 
 import "sync"
 
+// UserRequestQueue runs requests on a bounded number of workers, keeping the requests of each user in order.
 type UserRequestQueue struct {
 	mu     sync.Mutex
-	queues map[string]chan struct{}
+	queues map[string][]func()
+
+	// workers limits the requests running at the same time
+	workers chan struct{}
+
+	// maxPending limits the waiting requests of one user
+	maxPending int
+
+	wg sync.WaitGroup
 }
 
-func NewUserRequestQueue() *UserRequestQueue {
+func NewUserRequestQueue(workers int, maxPending int) *UserRequestQueue {
 	return &UserRequestQueue{
-		queues: make(map[string]chan struct{}),
+		queues:     make(map[string][]func()),
+		workers:    make(chan struct{}, workers),
+		maxPending: maxPending,
 	}
 }
 
-func (q *UserRequestQueue) getQueue(userID string) chan struct{} {
+// Process queues the request of the user without blocking.
+// It returns false and drops the request when the user has too many waiting requests.
+func (q *UserRequestQueue) Process(userID string, handler func()) bool {
 	q.mu.Lock()
 	defer q.mu.Unlock()
 
-	if _, exists := q.queues[userID]; !exists {
-		q.queues[userID] = make(chan struct{}, 1)
+	queue, running := q.queues[userID]
+	if len(queue) >= q.maxPending {
+		return false
+	}
+
+	q.queues[userID] = append(queue, handler)
+	q.wg.Add(1)
+
+	// the user's requests are already being run in order by a worker
+	if running {
+		return true
 	}
 
-	return q.queues[userID]
+	go q.run(userID)
+
+	return true
 }
 
-func (q *UserRequestQueue) Process(userID string, handler func()) {
-	queue := q.getQueue(userID)
+// Wait blocks until all queued requests are done.
+func (q *UserRequestQueue) Wait() {
+	q.wg.Wait()
+}
 
-	// Enqueue the request
-	queue <- struct{}{}
+// run runs the queued requests of the user one by one, until none is left.
+func (q *UserRequestQueue) run(userID string) {
+	for {
+		q.mu.Lock()
+		queue := q.queues[userID]
+		if len(queue) == 0 {
+			delete(q.queues, userID)
+			q.mu.Unlock()
+			return
+		}
+		handler := queue[0]
+		q.mu.Unlock()
 
-	go func() {
-		// Process the request
+		q.workers <- struct{}{}
 		handler()
+		<-q.workers
 
-		// Dequeue the request
-		<-queue
-	}()
+		q.mu.Lock()
+		q.queues[userID] = q.queues[userID][1:]
+		q.mu.Unlock()
+
+		q.wg.Done()
+	}
 }
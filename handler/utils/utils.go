@@ -1,6 +1,8 @@
 package utils
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"log"
 	"math"
 	"os"
@@ -17,6 +19,15 @@ func Getenv(key, fallback string) string {
 	return value
 }
 
+// GenerateToken returns a random hex token of the given size in bytes.
+func GenerateToken(size int) string {
+	token := make([]byte, size)
+	if _, err := rand.Read(token); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(token)
+}
+
 func LoadENV() {
 	err := godotenv.Load()
 
@@ -155,6 +166,16 @@ func GregorianToJalali(year, month, day int) (int, int, int) {
 	return jalaliYear, jalaliMonth, jalaliDay
 }
 
+// GetMenuIndex returns the index of the date in the two weeks menu rotation.
+func GetMenuIndex(date time.Time) int {
+
+	// find week number of year
+	weekNumber := GetJalaliWeekNumber(date)
+	faDayNumber := GetJalaliWeekDayNumber(date.Weekday())
+
+	return weekNumber*7 + faDayNumber - 1
+}
+
 func GetJalaliWeekNumber(date time.Time) int {
 
 	weekNumber := GetWeekNumber(date) % 2
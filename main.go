@@ -1,49 +1,207 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"log"
+	"luncher/handler/config"
 	"luncher/handler/database"
-	model "luncher/handler/models"
+	"luncher/handler/leader"
+	"luncher/handler/metrics"
+	"luncher/handler/scheduler"
+	"luncher/handler/storage"
 	"luncher/handler/utils"
+	"luncher/service/api"
+	"luncher/service/reservation"
 	"luncher/service/telegramBot"
+	"luncher/service/webhooks"
+	"net"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
+// mealCacheTTL bounds how long a menu changed on another replica takes to show
+const mealCacheTTL = 1 * time.Minute
+
 func main() {
 
+	configFile := flag.String("config", "", "optional YAML or JSON config file, overridden by the environment")
+	demo := flag.Bool("demo", false, "run on an in-memory store with demo data, without a database")
+	flag.Parse()
+
 	utils.LoadENV()
 
-	db := database.Connection()
-	db.Conn.AutoMigrate(&model.Reserve{}, &model.User{}, &model.Meal{})
+	if *configFile == "" {
+		*configFile = utils.Getenv("CONFIG_FILE", "")
+	}
+
+	conf, err := config.Load(*configFile)
+	if err != nil {
+		log.Fatalln("Invalid config:\n", err)
+	}
+
+	database.Configure(conf.Database)
+
+	if flag.Arg(0) == "migrate" {
+		runMigrate(flag.Args()[1:])
+		return
+	}
+
+	if err := conf.Validate(); err != nil {
+		log.Fatalln("Invalid config:\n", err)
+	}
+
+	log.Printf("Config:\n%s", conf)
+
+	store := openStore(*demo)
 
 	app := gin.Default()
 	gin.SetMode(gin.ReleaseMode)
 
-	// Set timezone globally
-	os.Setenv("TZ", "Asia/Tehran")                           // Change to your desired timezone
-	time.Local = time.FixedZone("Tehran Time", 3*3600+30*60) // (UTC+3:30)
+	log.Println(time.Now().In(conf.Location()))
+
+	// ctx is done on SIGINT or SIGTERM, stopping every loop started with it
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	telegramBot.LoadBot(conf, store)
+
+	jobs := newScheduler(conf, store)
+	telegramBot.SetScheduler(jobs)
+
+	// every instance records the webhook deliveries of its events, the leader sends them.
+	// Recording stops after shutdown, so the events of the updates drained then are kept too.
+	hooks := webhooks.New(store, conf.Webhooks)
+	recordCtx, stopRecording := context.WithCancel(context.Background())
+	recordDone := make(chan struct{})
+	go func() {
+		defer close(recordDone)
+		hooks.Record(recordCtx)
+	}()
+
+	// the scheduled jobs run on one instance only
+	elector := newElector(*demo)
+	jobsDone := make(chan struct{})
+	go func() {
+		defer close(jobsDone)
+		elector.Run(ctx, leader.All(jobs.Run, telegramBot.RunOutbox, hooks.Run))
+	}()
+
+	telegramBot.StartBotServer(ctx, app)
+
+	api.RegisterRoutes(app, conf, store)
+	api.SetScheduler(elector, jobs)
+
+	server := &http.Server{
+		Addr:    conf.HTTP.Addr,
+		Handler: app,
+
+		// requests get ctx, so long lived ones like the kitchen events end on shutdown
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Panic(err)
+		}
+	}()
+
+	<-ctx.Done()
+	stop()
 
-	log.Println(time.Now())
+	shutdownTimeout := time.Duration(conf.HTTP.ShutdownTimeout)
+	log.Printf("Shutting down, waiting up to %s", shutdownTimeout)
 
-	telegramBot.LoadBot()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
 
-	go telegramBot.Reminder()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Println("http server shutdown error", err)
+	}
 
-	telegramBot.StartBotServer()
+	if err := telegramBot.Shutdown(shutdownCtx); err != nil {
+		log.Println("bot shutdown error", err)
+	}
 
-	app.Run(":8085")
+	// after the bot, which triggers the manual runs
+	if err := jobs.Shutdown(shutdownCtx); err != nil {
+		log.Println("manual jobs shutdown error", err)
+	}
+
+	// the leader lock is released before the connections are closed
+	select {
+	case <-jobsDone:
+	case <-shutdownCtx.Done():
+		log.Println("scheduled jobs shutdown error", shutdownCtx.Err())
+	}
+
+	stopRecording()
+	<-recordDone
+
+	if err := database.Close(); err != nil {
+		log.Println("database close error", err)
+	}
+
+	log.Println("Shutdown complete")
 }
 
-func setTimeZone() {
+// openStore migrates and returns the postgres store, or a seeded in-memory store in demo mode.
+func openStore(demo bool) storage.Store {
+
+	if demo {
+		log.Println("Demo mode, data is kept in memory and lost on exit")
 
-	// Set the timezone globally
-	os.Setenv("TZ", "Asia/Tehran")
+		store := storage.NewMemory()
+		if err := storage.Seed(store); err != nil {
+			log.Fatalln("Seeding demo data failed:", err)
+		}
+
+		return store
+	}
+
+	if err := database.Migrate(); err != nil {
+		log.Fatalln("Migration failed:", err)
+	}
+
+	store := storage.NewCached(storage.NewGorm(database.Connection().Conn), mealCacheTTL)
+	metrics.RegisterCache("meals", store.MealCacheStats)
+
+	return store
+}
 
-	// Load location and set as the default
-	loc, _ := time.LoadLocation("Local")
-	time.Local = loc
+// newScheduler registers the scheduled jobs, in the timezone of the config.
+func newScheduler(conf *config.Config, store storage.Store) *scheduler.Scheduler {
 
-}
\ No newline at end of file
+	jobs := scheduler.New(store, conf.Location())
+
+	// a reminder is still worth sending an hour late, a cutoff webhook half a day late
+	if err := jobs.Register("reminder", conf.Reminder.CronExpression(), 1*time.Hour, telegramBot.SendReminders); err != nil {
+		log.Fatalln("Invalid config:", err)
+	}
+
+	policy := reservation.NewPolicy(conf)
+	jobs.RegisterSchedule("cutoff", reservation.CutoffSchedule{Policy: policy}, 12*time.Hour, policy.PublishCutoff)
+
+	return jobs
+}
+
+// newElector returns the leader election among the replicas, demo mode runs alone.
+func newElector(demo bool) leader.Elector {
+
+	if demo {
+		return &leader.Local{}
+	}
+
+	sqlDB, err := database.Connection().Conn.DB()
+	if err != nil {
+		log.Fatalln("Leader election failed:", err)
+	}
+
+	return leader.NewPostgres(sqlDB)
+}
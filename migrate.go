@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"luncher/handler/database"
+	"luncher/handler/migrations"
+	"os"
+	"strconv"
+)
+
+const migrateUsage = `usage: luncher migrate [up | down [steps] | status]
+
+  up      apply all pending migrations, the default
+  down    revert the last applied migrations, 1 by default
+  status  list the migrations and when they were applied`
+
+// runMigrate runs the migrate subcommand with its arguments.
+func runMigrate(args []string) {
+
+	command := "up"
+	if len(args) > 0 {
+		command = args[0]
+	}
+
+	sqlDB, err := database.Connection().Conn.DB()
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer database.Close()
+
+	ctx := context.Background()
+
+	switch command {
+	case "up":
+
+		count, err := migrations.Up(ctx, sqlDB)
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		fmt.Printf("Applied %d migrations\n", count)
+
+	case "down":
+
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				log.Fatalln("steps must be a positive number")
+			}
+		}
+
+		count, err := migrations.Down(ctx, sqlDB, steps)
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		fmt.Printf("Reverted %d migrations\n", count)
+
+	case "status":
+
+		statuses, err := migrations.List(ctx, sqlDB)
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		for _, status := range statuses {
+
+			appliedAt := "pending"
+			if status.AppliedAt != nil {
+				appliedAt = status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+
+			fmt.Printf("%04d %-40s %s\n", status.Version, status.Name, appliedAt)
+		}
+
+	default:
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,86 @@
+package api
+
+import (
+	"crypto/subtle"
+	"log"
+	"luncher/handler/config"
+	"luncher/handler/storage"
+	"luncher/service/reservation"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// store keeps the users, reserves and meals served by the handlers
+var store storage.Store
+
+// policy is when reserves can be changed, from the reserve config
+var policy reservation.Policy
+
+// RegisterRoutes mounts the versioned REST API on the given gin engine.
+func RegisterRoutes(app *gin.Engine, conf *config.Config, apiStore storage.Store) {
+
+	store = apiStore
+	policy = reservation.NewPolicy(conf)
+
+	registerHealthRoutes(app)
+	registerMetricsRoutes(app)
+	registerCalendarRoutes(app)
+	registerKitchenRoutes(app, conf.API.KitchenToken)
+
+	v1 := app.Group("/api/v1")
+
+	registerUserRoutes(v1, conf.API.Token)
+	registerAdminRoutes(v1, conf.API.AdminToken)
+	registerWebAppRoutes(app, v1, conf.Telegram.Token)
+}
+
+func registerUserRoutes(v1 *gin.RouterGroup, apiToken string) {
+
+	if apiToken == "" {
+		log.Println("API_TOKEN is not set, reserve API is disabled")
+		return
+	}
+
+	users := v1.Group("/users/:telegram_id", tokenAuth(apiToken), loadUser)
+	registerReserveRoutes(users)
+}
+
+func registerReserveRoutes(group *gin.RouterGroup) {
+	group.GET("/reserves", listReserves)
+	group.POST("/reserves", createReserve)
+	group.POST("/reserves/bulk", bulkReserve)
+	group.POST("/reserves/:date/toggle", toggleReserve)
+	group.DELETE("/reserves/:date", cancelReserve)
+}
+
+func registerAdminRoutes(v1 *gin.RouterGroup, adminToken string) {
+
+	if adminToken == "" {
+		log.Println("ADMIN_API_TOKEN is not set, admin API is disabled")
+		return
+	}
+
+	admin := v1.Group("/admin", tokenAuth(adminToken))
+	admin.GET("/meals", listMeals)
+	admin.PUT("/meals", replaceMeals)
+	admin.GET("/meals/:id", getMeal)
+	admin.PUT("/meals/:id", updateMeal)
+	admin.GET("/counts", getCounts)
+	admin.GET("/reserves", getReserves)
+}
+
+// tokenAuth rejects requests without the given bearer token.
+func tokenAuth(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		header := c.GetHeader("Authorization")
+		if !strings.HasPrefix(header, "Bearer ") || subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(header, "Bearer ")), []byte(token)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,128 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	model "luncher/handler/models"
+	"luncher/handler/storage"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// meal times of the calendar events, in local time
+const (
+	lunchStart    = 12*time.Hour + 30*time.Minute
+	dinnerStart   = 19 * time.Hour
+	mealDuration  = 1 * time.Hour
+	icsTimeFormat = "20060102T150405Z"
+)
+
+func registerCalendarRoutes(app *gin.Engine) {
+	app.GET("/calendar/:token", calendarFeed)
+}
+
+// calendarFeed serves the upcoming meals of the token owner as an iCalendar feed.
+func calendarFeed(c *gin.Context) {
+
+	token := strings.TrimSuffix(c.Param("token"), ".ics")
+
+	user, err := store.FindUserByCalendarToken(token)
+	if errors.Is(err, storage.ErrNotFound) || token == "" {
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		log.Println(err)
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	days, err := buildReserveDays(user)
+	if err != nil {
+		log.Println(err)
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+
+	lines := []string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//luncher//meals//FA",
+		"CALSCALE:GREGORIAN",
+		"METHOD:PUBLISH",
+		"X-WR-CALNAME:" + escapeICS("غذا"),
+	}
+
+	for _, day := range days {
+
+		date, _ := time.ParseInLocation("2006-01-02", day.Date, policy.Location)
+
+		if day.HasLunch {
+			lines = append(lines, icsEvent(user, date, "lunch", day.Lunch, lunchStart, now)...)
+		}
+
+		if day.HasDinner {
+			lines = append(lines, icsEvent(user, date, "dinner", day.Dinner, dinnerStart, now)...)
+		}
+	}
+
+	lines = append(lines, "END:VCALENDAR")
+
+	body := strings.Builder{}
+	for _, line := range lines {
+		body.WriteString(foldICS(line))
+		body.WriteString("\r\n")
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.Data(http.StatusOK, "text/calendar; charset=utf-8", []byte(body.String()))
+}
+
+func icsEvent(user model.User, date time.Time, meal string, dish string, start time.Duration, now time.Time) []string {
+
+	startTime := date.Add(start)
+
+	return []string{
+		"BEGIN:VEVENT",
+		fmt.Sprintf("UID:%s-%s-%d@luncher", date.Format("20060102"), meal, user.ID),
+		"DTSTAMP:" + now.UTC().Format(icsTimeFormat),
+		"DTSTART:" + startTime.UTC().Format(icsTimeFormat),
+		"DTEND:" + startTime.Add(mealDuration).UTC().Format(icsTimeFormat),
+		"SUMMARY:" + escapeICS(dish),
+		"CATEGORIES:" + strings.ToUpper(meal),
+		"TRANSP:TRANSPARENT",
+		"END:VEVENT",
+	}
+}
+
+func escapeICS(text string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`).Replace(text)
+}
+
+// foldICS splits lines longer than 75 octets, without breaking utf-8 characters.
+func foldICS(line string) string {
+
+	folded := strings.Builder{}
+	length := 0
+
+	for _, char := range line {
+
+		size := len(string(char))
+		if length+size > 75 {
+			folded.WriteString("\r\n ")
+			length = 1
+		}
+
+		folded.WriteRune(char)
+		length += size
+	}
+
+	return folded.String()
+}
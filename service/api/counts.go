@@ -0,0 +1,186 @@
+package api
+
+import (
+	"encoding/csv"
+	"fmt"
+	"log"
+	model "luncher/handler/models"
+	"luncher/service/reservation"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxReportDays limits the date range of a report request.
+const maxReportDays = 62
+
+type dayCount struct {
+	Date   string `json:"date"`
+	Lunch  int64  `json:"lunch"`
+	Dinner int64  `json:"dinner"`
+}
+
+type reserveUser struct {
+	TelegramID int64  `json:"telegram_id"`
+	Name       string `json:"name"`
+	Username   string `json:"username"`
+}
+
+type dayReserves struct {
+	Date   string        `json:"date"`
+	Lunch  []reserveUser `json:"lunch"`
+	Dinner []reserveUser `json:"dinner"`
+}
+
+// getCounts returns lunch and dinner totals of each day, like /getCounts in the bot.
+func getCounts(c *gin.Context) {
+
+	from, to, ok := parseDateRange(c)
+	if !ok {
+		return
+	}
+
+	dayCounts, err := reserveService().CountsForRange(from, to)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+
+	counts := []dayCount{}
+	for _, count := range dayCounts {
+		counts = append(counts, dayCount{Date: count.Date.Format("2006-01-02"), Lunch: count.Lunch, Dinner: count.Dinner})
+	}
+
+	if c.Query("format") == "csv" {
+
+		rows := [][]string{{"date", "lunch", "dinner"}}
+		for _, count := range counts {
+			rows = append(rows, []string{count.Date, strconv.FormatInt(count.Lunch, 10), strconv.FormatInt(count.Dinner, 10)})
+		}
+
+		writeCSV(c, "counts.csv", rows)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": counts})
+}
+
+// getReserves returns who has lunch and dinner on each day, like /getReserves in the bot.
+func getReserves(c *gin.Context) {
+
+	from, to, ok := parseDateRange(c)
+	if !ok {
+		return
+	}
+
+	dayUsers, err := reserveService().UsersForRange(from, to)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+
+	days := []dayReserves{}
+	for _, day := range dayUsers {
+		days = append(days, newDayReserves(day))
+	}
+
+	if c.Query("format") == "csv" {
+
+		rows := [][]string{{"date", "meal", "telegram_id", "name", "username"}}
+		for _, day := range days {
+			for _, user := range day.Lunch {
+				rows = append(rows, []string{day.Date, "lunch", strconv.FormatInt(user.TelegramID, 10), escapeCSVCell(user.Name), escapeCSVCell(user.Username)})
+			}
+			for _, user := range day.Dinner {
+				rows = append(rows, []string{day.Date, "dinner", strconv.FormatInt(user.TelegramID, 10), escapeCSVCell(user.Name), escapeCSVCell(user.Username)})
+			}
+		}
+
+		writeCSV(c, "reserves.csv", rows)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": days})
+}
+
+func newDayReserves(day reservation.DayUsers) dayReserves {
+	return dayReserves{
+		Date:   day.Date.Format("2006-01-02"),
+		Lunch:  newReserveUsers(day.Lunch),
+		Dinner: newReserveUsers(day.Dinner),
+	}
+}
+
+func newReserveUsers(users []model.User) []reserveUser {
+
+	result := []reserveUser{}
+	for _, user := range users {
+		result = append(result, reserveUser{TelegramID: user.TelegramID, Name: user.Name, Username: user.Username})
+	}
+
+	return result
+}
+
+// parseDateRange reads the from and to query params, defaulting to the planning window.
+func parseDateRange(c *gin.Context) (time.Time, time.Time, bool) {
+
+	from := policy.Today()
+	if value := c.Query("from"); value != "" {
+		date, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid from date, expected YYYY-MM-DD"})
+			return from, from, false
+		}
+		from = date
+	}
+
+	to := policy.LastDay(from)
+	if value := c.Query("to"); value != "" {
+		date, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid to date, expected YYYY-MM-DD"})
+			return from, from, false
+		}
+		to = date
+	}
+
+	if to.Before(from) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "to date is before from date"})
+		return from, from, false
+	}
+
+	if to.Sub(from) >= maxReportDays*24*time.Hour {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("date range is longer than %d days", maxReportDays)})
+		return from, from, false
+	}
+
+	return from, to, true
+}
+
+func writeCSV(c *gin.Context, filename string, rows [][]string) {
+
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Status(http.StatusOK)
+
+	writer := csv.NewWriter(c.Writer)
+	if err := writer.WriteAll(rows); err != nil {
+		log.Println("write csv error", err)
+	}
+}
+
+// escapeCSVCell keeps free text cells like user names from running as formulas when the export is opened in a spreadsheet.
+// Numbers are written as they are, a negative chat ID must stay a number.
+func escapeCSVCell(cell string) string {
+
+	if cell != "" && strings.ContainsRune("=+-@\t\r", rune(cell[0])) {
+		return "'" + cell
+	}
+
+	return cell
+}
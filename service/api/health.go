@@ -0,0 +1,132 @@
+package api
+
+import (
+	"context"
+	"luncher/handler/leader"
+	"luncher/handler/scheduler"
+	"luncher/service/telegramBot"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// updatesMaxAge is the max time between two getUpdates responses, long polling timeout is 60 seconds.
+	updatesMaxAge = 3 * time.Minute
+
+	// schedulerMaxAge is the max time between two heartbeats of a job loop while leading, a run stuck for longer fails too.
+	schedulerMaxAge = 3 * scheduler.HeartbeatInterval
+
+	dbPingTimeout = 2 * time.Second
+)
+
+// elector and jobs are checked by the health routes, the scheduler only while this instance leads
+var elector leader.Elector
+var jobs *scheduler.Scheduler
+
+// SetScheduler makes the health routes check the scheduled jobs run on the leader.
+func SetScheduler(e leader.Elector, s *scheduler.Scheduler) {
+	elector = e
+	jobs = s
+}
+
+type healthCheck struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+func registerHealthRoutes(app *gin.Engine) {
+	app.GET("/healthz", healthz)
+	app.GET("/readyz", readyz)
+}
+
+// healthz fails when a bot loop is hung, so the process gets restarted.
+func healthz(c *gin.Context) {
+
+	status := telegramBot.GetStatus()
+
+	checks := botChecks(status, time.Now())
+
+	writeHealth(c, status, checks)
+}
+
+// readyz also fails when the database is unreachable.
+func readyz(c *gin.Context) {
+
+	status := telegramBot.GetStatus()
+
+	checks := botChecks(status, time.Now())
+	checks["database"] = pingDatabase(c.Request.Context())
+
+	writeHealth(c, status, checks)
+}
+
+func botChecks(status telegramBot.Status, now time.Time) map[string]healthCheck {
+
+	checks := map[string]healthCheck{}
+
+	// webhook updates only arrive when users send something, so their age tells nothing
+	if status.Mode == "polling" {
+
+		lastUpdatesAt := status.LastUpdatesAt
+		if lastUpdatesAt.IsZero() {
+			lastUpdatesAt = status.StartedAt
+		}
+
+		checks["telegram"] = checkAge(lastUpdatesAt, now, updatesMaxAge, "no getUpdates response since ")
+	}
+
+	// followers don't run the scheduled jobs, so only the leader checks them
+	if isLeader() && jobs != nil {
+		checks["scheduler"] = checkAge(jobs.Heartbeat(), now, schedulerMaxAge, "a job loop has not beat since ")
+	}
+
+	return checks
+}
+
+func isLeader() bool {
+	return elector != nil && elector.IsLeader()
+}
+
+func checkAge(last time.Time, now time.Time, maxAge time.Duration, message string) healthCheck {
+
+	if last.IsZero() {
+		return healthCheck{Error: "not started"}
+	}
+
+	if now.Sub(last) > maxAge {
+		return healthCheck{Error: message + last.Format(time.RFC3339)}
+	}
+
+	return healthCheck{OK: true}
+}
+
+func pingDatabase(ctx context.Context) healthCheck {
+
+	ctx, cancel := context.WithTimeout(ctx, dbPingTimeout)
+	defer cancel()
+
+	if err := store.Ping(ctx); err != nil {
+		return healthCheck{Error: err.Error()}
+	}
+
+	return healthCheck{OK: true}
+}
+
+func writeHealth(c *gin.Context, status telegramBot.Status, checks map[string]healthCheck) {
+
+	code := http.StatusOK
+	for _, check := range checks {
+		if !check.OK {
+			code = http.StatusServiceUnavailable
+		}
+	}
+
+	c.JSON(code, gin.H{
+		"status": http.StatusText(code),
+		"checks": checks,
+		"leader": isLeader(),
+		"bot":    status,
+	})
+}
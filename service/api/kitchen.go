@@ -0,0 +1,122 @@
+package api
+
+import (
+	"crypto/subtle"
+	_ "embed"
+	"log"
+	"luncher/handler/events"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// kitchenRefresh is the interval of snapshots sent without a change on this instance.
+// Reserves made on other replicas aren't published here, and the snapshots keep the stream open through proxies.
+const kitchenRefresh = 30 * time.Second
+
+//go:embed kitchen/index.html
+var kitchenPage []byte
+
+type kitchenDay struct {
+	dayReserves
+	LunchCount  int `json:"lunch_count"`
+	DinnerCount int `json:"dinner_count"`
+}
+
+func registerKitchenRoutes(app *gin.Engine, kitchenToken string) {
+
+	if kitchenToken == "" {
+		log.Println("KITCHEN_TOKEN is not set, kitchen display is disabled")
+		return
+	}
+
+	kitchen := app.Group("/kitchen", queryTokenAuth(kitchenToken))
+	kitchen.GET("", func(c *gin.Context) {
+		c.Data(http.StatusOK, "text/html; charset=utf-8", kitchenPage)
+	})
+	kitchen.GET("/events", kitchenEvents)
+}
+
+// queryTokenAuth checks the token query param, EventSource can not send headers.
+func queryTokenAuth(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		if subtle.ConstantTimeCompare([]byte(c.Query("token")), []byte(token)) != 1 {
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// kitchenEvents streams today's and tomorrow's reserves, sent again on every change on this instance and every kitchenRefresh.
+func kitchenEvents(c *gin.Context) {
+
+	changes, unsubscribe := events.Subscribe(16)
+	defer unsubscribe()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+
+	sendKitchenSnapshot(c)
+
+	refresh := time.NewTicker(kitchenRefresh)
+	defer refresh.Stop()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+
+		case <-changes:
+			// send one snapshot for a burst of changes, like selecting all lunches
+			drainEvents(changes)
+			sendKitchenSnapshot(c)
+			refresh.Reset(kitchenRefresh)
+
+		case <-refresh.C:
+			// also moves the display to the next day at midnight, and past the cutoff published on the leader
+			sendKitchenSnapshot(c)
+		}
+	}
+}
+
+func drainEvents(changes <-chan events.Event) {
+	for {
+		select {
+		case <-changes:
+		default:
+			return
+		}
+	}
+}
+
+func sendKitchenSnapshot(c *gin.Context) {
+
+	today := policy.Today()
+
+	dayUsers, err := reserveService().UsersForRange(today, today.AddDate(0, 0, 1))
+	if err != nil {
+		log.Println("kitchen snapshot error", err)
+
+		// the display keeps its last snapshot, the stream stays open
+		c.Writer.WriteString(": keep-alive\n\n")
+		c.Writer.Flush()
+		return
+	}
+
+	days := []kitchenDay{}
+	for _, day := range dayUsers {
+		days = append(days, kitchenDay{
+			dayReserves: newDayReserves(day),
+			LunchCount:  len(day.Lunch),
+			DinnerCount: len(day.Dinner),
+		})
+	}
+
+	c.SSEvent("snapshot", days)
+	c.Writer.Flush()
+}
@@ -0,0 +1,206 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"luncher/handler/events"
+	model "luncher/handler/models"
+	"luncher/handler/storage"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+type mealRequest struct {
+	ID     uint    `json:"id"`
+	Lunch  *string `json:"lunch"`
+	Dinner *string `json:"dinner"`
+}
+
+// listMeals returns all slots of the menu rotation, empty ones included.
+func listMeals(c *gin.Context) {
+
+	meals, err := store.ListMeals()
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+
+	slots := make([]model.Meal, model.MenuSlots)
+	for i := range slots {
+		slots[i].ID = uint(i + 1)
+	}
+
+	for _, meal := range meals {
+		if meal.ID >= 1 && meal.ID <= model.MenuSlots {
+			slots[meal.ID-1] = meal
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": slots})
+}
+
+// replaceMeals replaces the whole menu rotation in one transaction.
+func replaceMeals(c *gin.Context) {
+
+	var request []mealRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if len(request) != model.MenuSlots {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": fmt.Sprintf("expected %d meals, got %d", model.MenuSlots, len(request))})
+		return
+	}
+
+	seen := map[uint]bool{}
+	meals := []model.Meal{}
+
+	for _, item := range request {
+
+		if err := validateMealID(item.ID); err != nil {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+			return
+		}
+
+		if seen[item.ID] {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": fmt.Sprintf("duplicate meal id %d", item.ID)})
+			return
+		}
+		seen[item.ID] = true
+
+		meal, err := buildMeal(item.ID, item)
+		if err != nil {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+			return
+		}
+
+		meals = append(meals, meal)
+	}
+
+	if err := store.SaveMeals(meals...); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+
+	for _, meal := range meals {
+		events.Publish(events.MenuChanged, meal)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": meals})
+}
+
+// getMeal returns one slot of the menu rotation.
+func getMeal(c *gin.Context) {
+
+	id, ok := parseMealID(c)
+	if !ok {
+		return
+	}
+
+	meal, err := store.FindMeal(id)
+	if errors.Is(err, storage.ErrNotFound) {
+		meal, err = model.Meal{ID: id}, nil
+	}
+
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": meal})
+}
+
+// updateMeal replaces one slot of the menu rotation.
+func updateMeal(c *gin.Context) {
+
+	id, ok := parseMealID(c)
+	if !ok {
+		return
+	}
+
+	var request mealRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	meal, err := buildMeal(id, request)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := store.SaveMeals(meal); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+
+	events.Publish(events.MenuChanged, meal)
+
+	c.JSON(http.StatusOK, gin.H{"data": meal})
+}
+
+func parseMealID(c *gin.Context) (uint, bool) {
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err == nil {
+		err = validateMealID(uint(id))
+	}
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("meal id must be between 1 and %d", model.MenuSlots)})
+		return 0, false
+	}
+
+	return uint(id), true
+}
+
+func validateMealID(id uint) error {
+	if id < 1 || id > model.MenuSlots {
+		return fmt.Errorf("meal id %d must be between 1 and %d", id, model.MenuSlots)
+	}
+	return nil
+}
+
+// buildMeal validates dish names, empty names clear the slot back to the default name.
+func buildMeal(id uint, request mealRequest) (model.Meal, error) {
+
+	lunch, err := normalizeMealName(request.Lunch)
+	if err != nil {
+		return model.Meal{}, fmt.Errorf("lunch of meal %d: %w", id, err)
+	}
+
+	dinner, err := normalizeMealName(request.Dinner)
+	if err != nil {
+		return model.Meal{}, fmt.Errorf("dinner of meal %d: %w", id, err)
+	}
+
+	return model.Meal{ID: id, Lunch: lunch, Dinner: dinner}, nil
+}
+
+func normalizeMealName(name *string) (*string, error) {
+	if name == nil {
+		return nil, nil
+	}
+
+	trimmed := strings.TrimSpace(*name)
+	if trimmed == "" {
+		return nil, nil
+	}
+
+	if utf8.RuneCountInString(trimmed) > model.MealNameMaxLength {
+		return nil, fmt.Errorf("name is longer than %d characters", model.MealNameMaxLength)
+	}
+
+	return &trimmed, nil
+}
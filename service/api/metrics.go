@@ -0,0 +1,20 @@
+package api
+
+import (
+	"luncher/handler/metrics"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+func registerMetricsRoutes(app *gin.Engine) {
+
+	metrics.RegisterDailyCounts(func() (int64, int64, error) {
+
+		count, err := reserveService().CountDay(policy.Today())
+
+		return count.Lunch, count.Dinner, err
+	})
+
+	app.GET("/metrics", gin.WrapH(promhttp.Handler()))
+}
@@ -0,0 +1,232 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	model "luncher/handler/models"
+	"luncher/handler/storage"
+	"luncher/handler/utils"
+	"luncher/service/reservation"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	Jalaali "github.com/jalaali/go-jalaali"
+)
+
+// userKey is the gin context key of the user loaded by the auth middlewares.
+const userKey = "user"
+
+type reserveDay struct {
+	Date       string `json:"date"`
+	DayName    string `json:"day_name"`
+	JalaliDate string `json:"jalali_date"`
+	Lunch      string `json:"lunch"`
+	Dinner     string `json:"dinner"`
+	HasLunch   bool   `json:"has_lunch"`
+	HasDinner  bool   `json:"has_dinner"`
+	Reserved   bool   `json:"reserved"`
+	Locked     bool   `json:"locked"`
+}
+
+type reserveRequest struct {
+	Date      string `json:"date" binding:"required"`
+	HasLunch  bool   `json:"has_lunch"`
+	HasDinner bool   `json:"has_dinner"`
+}
+
+type toggleRequest struct {
+	Meal string `json:"meal" binding:"required,oneof=lunch dinner"`
+}
+
+type bulkRequest struct {
+	Meal  string `json:"meal" binding:"required,oneof=lunch dinner"`
+	Value bool   `json:"value"`
+}
+
+// listReserves returns the effective reserve of every day in the planning window.
+func listReserves(c *gin.Context) {
+
+	user := c.MustGet(userKey).(model.User)
+
+	days, err := buildReserveDays(user)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": days})
+}
+
+// createReserve creates or replaces the reserve of a day.
+func createReserve(c *gin.Context) {
+
+	user := c.MustGet(userKey).(model.User)
+
+	var request reserveRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	date, ok := parseDate(c, request.Date)
+	if !ok {
+		return
+	}
+
+	reserve, err := reserveService().Set(user, date, request.HasLunch, request.HasDinner)
+	writeReserve(c, reserve, err)
+}
+
+// toggleReserve flips lunch or dinner of a day, like pressing its button in the bot.
+func toggleReserve(c *gin.Context) {
+
+	user := c.MustGet(userKey).(model.User)
+
+	var request toggleRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	date, ok := parseDate(c, c.Param("date"))
+	if !ok {
+		return
+	}
+
+	reserve, err := reserveService().Toggle(user, date, reservation.Meal(request.Meal))
+	writeReserve(c, reserve, err)
+}
+
+// bulkReserve sets lunch or dinner of every day that can still be changed.
+func bulkReserve(c *gin.Context) {
+
+	user := c.MustGet(userKey).(model.User)
+
+	var request bulkRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if _, err := reserveService().BulkSet(user, reservation.Meal(request.Meal), request.Value); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+
+	listReserves(c)
+}
+
+// cancelReserve removes both meals of a day, overriding always lunch and dinner.
+func cancelReserve(c *gin.Context) {
+
+	user := c.MustGet(userKey).(model.User)
+
+	date, ok := parseDate(c, c.Param("date"))
+	if !ok {
+		return
+	}
+
+	reserve, err := reserveService().Cancel(user, date)
+	writeReserve(c, reserve, err)
+}
+
+// loadUser loads the user of the telegram_id path param into the context.
+func loadUser(c *gin.Context) {
+
+	telegramID, err := strconv.ParseInt(c.Param("telegram_id"), 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid telegram id"})
+		return
+	}
+
+	setUser(c, telegramID)
+}
+
+func setUser(c *gin.Context, telegramID int64) {
+
+	user, err := store.FindUser(telegramID)
+	if errors.Is(err, storage.ErrNotFound) {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+
+	c.Set(userKey, user)
+	c.Next()
+}
+
+func reserveService() *reservation.Service {
+	return reservation.NewService(store, policy, "api")
+}
+
+// buildReserveDays returns the planning window of the user with dish names and lock state.
+func buildReserveDays(user model.User) ([]reserveDay, error) {
+
+	reserveDays, err := reserveService().Days(user)
+	if err != nil {
+		return nil, err
+	}
+
+	days := []reserveDay{}
+	for _, day := range reserveDays {
+		days = append(days, newReserveDay(day))
+	}
+
+	return days, nil
+}
+
+func newReserveDay(day reservation.Day) reserveDay {
+
+	jYear, jMonth, jDay, _ := Jalaali.ToJalaali(day.Date.Year(), day.Date.Month(), day.Date.Day())
+
+	return reserveDay{
+		Date:       day.Date.Format("2006-01-02"),
+		DayName:    utils.GetFaDayName(day.Date.Weekday()),
+		JalaliDate: fmt.Sprintf("%d/%d/%d", jYear, jMonth, jDay),
+		Lunch:      day.LunchName,
+		Dinner:     day.DinnerName,
+		HasLunch:   day.HasLunch,
+		HasDinner:  day.HasDinner,
+		Reserved:   day.Reserved,
+		Locked:     day.Locked,
+	}
+}
+
+func parseDate(c *gin.Context, value string) (time.Time, bool) {
+
+	date, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid date, expected YYYY-MM-DD"})
+		return date, false
+	}
+
+	return date, true
+}
+
+// writeReserve responds with the saved reserve or maps the reservation error to a status.
+func writeReserve(c *gin.Context, reserve model.Reserve, err error) {
+
+	switch {
+	case errors.Is(err, reservation.ErrOutOfWindow):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+	case errors.Is(err, reservation.ErrDeadlinePassed):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, reservation.ErrInvalidMeal):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case err != nil:
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+	default:
+		c.JSON(http.StatusOK, gin.H{"data": reserve})
+	}
+}
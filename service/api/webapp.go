@@ -0,0 +1,114 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// initDataMaxAge is how long a mini app session is accepted after telegram signed it.
+const initDataMaxAge = 24 * time.Hour
+
+//go:embed webapp/index.html
+var webAppPage []byte
+
+// registerWebAppRoutes serves the telegram mini app page and its API.
+func registerWebAppRoutes(app *gin.Engine, v1 *gin.RouterGroup, botToken string) {
+
+	app.GET("/webapp", func(c *gin.Context) {
+		c.Data(http.StatusOK, "text/html; charset=utf-8", webAppPage)
+	})
+
+	webApp := v1.Group("/webapp", webAppAuth(botToken))
+	registerReserveRoutes(webApp)
+}
+
+// webAppAuth loads the user of a mini app request, authorized by "Authorization: tma <initData>".
+func webAppAuth(botToken string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		initData, found := strings.CutPrefix(c.GetHeader("Authorization"), "tma ")
+		if !found {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		telegramID, err := verifyInitData(initData, botToken, time.Now())
+		if err != nil {
+			log.Println("invalid web app init data", err)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		setUser(c, telegramID)
+	}
+}
+
+// verifyInitData checks the signature of the mini app init data and returns the telegram id of its user.
+// https://core.telegram.org/bots/webapps#validating-data-received-via-the-mini-app
+func verifyInitData(initData string, botToken string, now time.Time) (int64, error) {
+
+	values, err := url.ParseQuery(initData)
+	if err != nil {
+		return 0, err
+	}
+
+	hash := values.Get("hash")
+	if hash == "" {
+		return 0, errors.New("hash is missing")
+	}
+
+	keys := []string{}
+	for key := range values {
+		if key != "hash" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	pairs := []string{}
+	for _, key := range keys {
+		pairs = append(pairs, key+"="+values.Get(key))
+	}
+
+	secret := hmac.New(sha256.New, []byte("WebAppData"))
+	secret.Write([]byte(botToken))
+
+	signature := hmac.New(sha256.New, secret.Sum(nil))
+	signature.Write([]byte(strings.Join(pairs, "\n")))
+
+	expected := hex.EncodeToString(signature.Sum(nil))
+	if !hmac.Equal([]byte(expected), []byte(hash)) {
+		return 0, errors.New("hash mismatch")
+	}
+
+	authDate, err := strconv.ParseInt(values.Get("auth_date"), 10, 64)
+	if err != nil {
+		return 0, errors.New("invalid auth_date")
+	}
+
+	if now.Sub(time.Unix(authDate, 0)) > initDataMaxAge {
+		return 0, errors.New("init data is expired")
+	}
+
+	var user struct {
+		ID int64 `json:"id"`
+	}
+	if err := json.Unmarshal([]byte(values.Get("user")), &user); err != nil || user.ID == 0 {
+		return 0, errors.New("invalid user")
+	}
+
+	return user.ID, nil
+}
@@ -0,0 +1,78 @@
+package reservation
+
+import (
+	model "luncher/handler/models"
+	"time"
+)
+
+type DayCount struct {
+	Date   time.Time
+	Lunch  int64
+	Dinner int64
+}
+
+type DayUsers struct {
+	Date   time.Time
+	Lunch  []model.User
+	Dinner []model.User
+}
+
+// CountsForRange returns the number of lunches and dinners of each day from from to to, both included.
+func (s *Service) CountsForRange(from time.Time, to time.Time) ([]DayCount, error) {
+
+	counts := []DayCount{}
+	for date := from; !date.After(to); date = date.AddDate(0, 0, 1) {
+
+		count, err := s.CountDay(date)
+		if err != nil {
+			return nil, err
+		}
+
+		counts = append(counts, count)
+	}
+
+	return counts, nil
+}
+
+func (s *Service) CountDay(date time.Time) (DayCount, error) {
+
+	day, err := s.UsersForDay(date)
+
+	return DayCount{Date: date, Lunch: int64(len(day.Lunch)), Dinner: int64(len(day.Dinner))}, err
+}
+
+// UsersForRange returns who has lunch and dinner on each day from from to to, both included.
+func (s *Service) UsersForRange(from time.Time, to time.Time) ([]DayUsers, error) {
+
+	days := []DayUsers{}
+	for date := from; !date.After(to); date = date.AddDate(0, 0, 1) {
+
+		day, err := s.UsersForDay(date)
+		if err != nil {
+			return nil, err
+		}
+
+		days = append(days, day)
+	}
+
+	return days, nil
+}
+
+func (s *Service) UsersForDay(date time.Time) (DayUsers, error) {
+
+	day := DayUsers{Date: date}
+
+	lunch, err := s.store.LunchUsers(date)
+	if err != nil {
+		return day, err
+	}
+
+	dinner, err := s.store.DinnerUsers(date)
+	if err != nil {
+		return day, err
+	}
+
+	day.Lunch, day.Dinner = lunch, dinner
+
+	return day, nil
+}
@@ -0,0 +1,106 @@
+package reservation
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"luncher/handler/config"
+	"luncher/handler/events"
+	"time"
+)
+
+// Policy is when reserves can be changed, from the reserve config.
+type Policy struct {
+	// PlanningDays is the number of days, starting today, that can be reserved.
+	PlanningDays int
+
+	// Cutoff is the time of the day before, after which the reserve of a day can't be changed.
+	Cutoff time.Duration
+
+	// Location is the timezone of Cutoff and of today.
+	Location *time.Location
+}
+
+// NewPolicy returns the policy of the reserve config, in the timezone loaded by Validate.
+func NewPolicy(conf *config.Config) Policy {
+	return Policy{
+		PlanningDays: conf.Reserve.PlanningDays,
+		Cutoff:       time.Duration(conf.Reserve.Cutoff),
+		Location:     conf.Location(),
+	}
+}
+
+// Today returns the date of today in the timezone of the policy, as dates are stored at midnight UTC.
+func (p Policy) Today() time.Time {
+	return DateOf(time.Now().In(p.Location))
+}
+
+// Window returns the days, starting today, that can be reserved.
+func (p Policy) Window() []time.Time {
+
+	today := p.Today()
+
+	dates := []time.Time{}
+	for i := 0; i < p.PlanningDays; i++ {
+		dates = append(dates, today.AddDate(0, 0, i))
+	}
+
+	return dates
+}
+
+// LastDay returns the last day of the window starting at from.
+func (p Policy) LastDay(from time.Time) time.Time {
+	return from.AddDate(0, 0, p.PlanningDays-1)
+}
+
+// Deadline returns the last time the reserve of the given date can be changed,
+// the day before at Cutoff, in Location.
+func (p Policy) Deadline(date time.Time) time.Time {
+	year, month, day := date.Date()
+	return time.Date(year, month, day-1, 0, 0, 0, 0, p.Location).Add(p.Cutoff)
+}
+
+func (p Policy) IsLocked(date time.Time) bool {
+	return time.Now().After(p.Deadline(date))
+}
+
+// CutoffClock returns the cutoff like "17:30".
+func (p Policy) CutoffClock() string {
+	return fmt.Sprintf("%02d:%02d", int(p.Cutoff.Hours()), int(p.Cutoff.Minutes())%60)
+}
+
+// PublishCutoff publishes CutoffReached for the last day whose edit time passed at scheduledAt, it's run by the scheduler.
+func (p Policy) PublishCutoff(ctx context.Context, scheduledAt time.Time) error {
+
+	date := p.nextCutoffDate(scheduledAt).AddDate(0, 0, -1)
+
+	log.Printf("Cutoff reached for %s", date.Format("2006-01-02"))
+	events.Publish(events.CutoffReached, map[string]string{"date": date.Format("2006-01-02")})
+
+	return nil
+}
+
+// nextCutoffDate returns the first day whose edit time has not passed yet.
+func (p Policy) nextCutoffDate(now time.Time) time.Time {
+
+	date := DateOf(now.In(p.Location))
+
+	for !now.Before(p.Deadline(date)) {
+		date = date.AddDate(0, 0, 1)
+	}
+
+	return date
+}
+
+// CutoffSchedule runs a job every time the edit time of a day passes.
+type CutoffSchedule struct {
+	Policy Policy
+}
+
+func (s CutoffSchedule) Next(after time.Time) time.Time {
+	return s.Policy.Deadline(s.Policy.nextCutoffDate(after))
+}
+
+func (s CutoffSchedule) String() string {
+	return fmt.Sprintf("daily at the cutoff, %s %s", s.Policy.CutoffClock(), s.Policy.Location)
+}
@@ -0,0 +1,40 @@
+package reservation
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPolicyDeadline(t *testing.T) {
+
+	tehran, err := time.LoadLocation("Asia/Tehran")
+	if err != nil {
+		t.Skip("no timezone data", err)
+	}
+
+	policy := Policy{PlanningDays: 14, Cutoff: 17*time.Hour + 30*time.Minute, Location: tehran}
+
+	// dates are kept at midnight UTC
+	date := time.Date(2024, 11, 5, 0, 0, 0, 0, time.UTC)
+
+	deadline := policy.Deadline(date)
+
+	want := time.Date(2024, 11, 4, 17, 30, 0, 0, tehran)
+	if !deadline.Equal(want) {
+		t.Fatalf("deadline is %s, want %s", deadline, want)
+	}
+
+	// 14:00 UTC is the cutoff in Tehran, at +03:30
+	if utc := deadline.UTC(); utc.Hour() != 14 || utc.Minute() != 0 {
+		t.Fatalf("deadline is %s UTC, want 14:00", utc.Format("15:04"))
+	}
+
+	schedule := CutoffSchedule{Policy: policy}
+	if next := schedule.Next(deadline.Add(-time.Minute)); !next.Equal(deadline) {
+		t.Fatalf("next cutoff is %s, want %s", next, deadline)
+	}
+
+	if text := schedule.String(); text != "daily at the cutoff, 17:30 Asia/Tehran" {
+		t.Fatalf("schedule is %q", text)
+	}
+}
@@ -0,0 +1,314 @@
+package reservation
+
+import (
+	"errors"
+	"luncher/handler/events"
+	"luncher/handler/metrics"
+	model "luncher/handler/models"
+	"luncher/handler/storage"
+	"luncher/handler/utils"
+	"time"
+)
+
+type Meal string
+
+const (
+	Lunch  Meal = "lunch"
+	Dinner Meal = "dinner"
+)
+
+var (
+	ErrDeadlinePassed = errors.New("edit time for this day has passed")
+	ErrOutOfWindow    = errors.New("date is out of the planning window")
+	ErrInvalidMeal    = errors.New("meal must be lunch or dinner")
+)
+
+// Service holds the reservation rules shared by the bot, the HTTP API and other tools.
+type Service struct {
+	store  storage.Store
+	policy Policy
+
+	// source labels the reserve change metrics, like "bot" or "api".
+	source string
+}
+
+func NewService(store storage.Store, policy Policy, source string) *Service {
+	return &Service{store: store, policy: policy, source: source}
+}
+
+// Day is the effective reserve of a user on a day, falling back to always lunch and dinner.
+type Day struct {
+	Date       time.Time
+	LunchName  string
+	DinnerName string
+	HasLunch   bool
+	HasDinner  bool
+	Reserved   bool
+	Locked     bool
+}
+
+// DateOf returns the calendar date of t at midnight UTC.
+func DateOf(t time.Time) time.Time {
+	date, _ := time.Parse("2006-01-02", t.Format("2006-01-02"))
+	return date
+}
+
+// CheckEditable returns an error when the date is out of the planning window or its deadline has passed.
+func (s *Service) CheckEditable(date time.Time) error {
+
+	today := s.policy.Today()
+	if date.Before(today) || date.After(s.policy.LastDay(today)) {
+		return ErrOutOfWindow
+	}
+
+	if s.policy.IsLocked(date) {
+		metrics.CutoffRejections.WithLabelValues(s.source).Inc()
+		return ErrDeadlinePassed
+	}
+
+	return nil
+}
+
+// Find loads the reserve of a day or returns a new one using the user settings.
+func (s *Service) Find(user model.User, date time.Time) (model.Reserve, error) {
+
+	reserve, err := s.store.FindReserve(user.ID, date)
+
+	if errors.Is(err, storage.ErrNotFound) {
+		return model.Reserve{
+			Date:      date,
+			UserID:    user.ID,
+			HasLunch:  user.AlwaysLunch,
+			HasDinner: user.AlwaysDinner,
+		}, nil
+	}
+
+	return reserve, err
+}
+
+// Toggle flips a meal of a day.
+func (s *Service) Toggle(user model.User, date time.Time, meal Meal) (model.Reserve, error) {
+	return s.update(user, date, func(reserve *model.Reserve) error {
+
+		switch meal {
+		case Lunch:
+			reserve.HasLunch = !reserve.HasLunch
+		case Dinner:
+			reserve.HasDinner = !reserve.HasDinner
+		default:
+			return ErrInvalidMeal
+		}
+
+		return nil
+	})
+}
+
+// Set replaces both meals of a day.
+func (s *Service) Set(user model.User, date time.Time, hasLunch bool, hasDinner bool) (model.Reserve, error) {
+	return s.update(user, date, func(reserve *model.Reserve) error {
+
+		reserve.HasLunch = hasLunch
+		reserve.HasDinner = hasDinner
+
+		return nil
+	})
+}
+
+// Cancel removes both meals of a day, overriding always lunch and dinner.
+func (s *Service) Cancel(user model.User, date time.Time) (model.Reserve, error) {
+	return s.Set(user, date, false, false)
+}
+
+// BulkSet sets a meal on every day of the planning window that can still be changed.
+func (s *Service) BulkSet(user model.User, meal Meal, value bool) ([]model.Reserve, error) {
+
+	if meal != Lunch && meal != Dinner {
+		return nil, ErrInvalidMeal
+	}
+
+	saved := []model.Reserve{}
+	created := []bool{}
+
+	err := s.store.Transaction(func(store storage.Store) error {
+
+		if err := store.LockReserves(user.ID); err != nil {
+			return err
+		}
+
+		service := NewService(store, s.policy, s.source)
+
+		for _, date := range s.policy.Window() {
+
+			if s.policy.IsLocked(date) {
+				continue
+			}
+
+			reserve, err := service.Find(user, date)
+			if err != nil {
+				return err
+			}
+
+			if meal == Lunch {
+				reserve.HasLunch = value
+			} else {
+				reserve.HasDinner = value
+			}
+
+			created = append(created, reserve.ID == 0)
+			if err := store.SaveReserve(&reserve); err != nil {
+				return err
+			}
+
+			saved = append(saved, reserve)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	for i, reserve := range saved {
+		s.published(reserve, created[i])
+	}
+
+	return saved, nil
+}
+
+// DayState returns the effective reserve of the user on the date.
+func (s *Service) DayState(user model.User, date time.Time) (Day, error) {
+
+	days, err := s.days(user, []time.Time{date})
+	if err != nil {
+		return Day{}, err
+	}
+
+	return days[0], nil
+}
+
+// Days returns the effective reserves of the user in the planning window.
+func (s *Service) Days(user model.User) ([]Day, error) {
+	return s.days(user, s.policy.Window())
+}
+
+func (s *Service) days(user model.User, dates []time.Time) ([]Day, error) {
+
+	reserves, err := s.store.ListReserves(user.ID, dates[0], dates[len(dates)-1])
+	if err != nil {
+		return nil, err
+	}
+
+	lunches, dinners, err := s.Menu()
+	if err != nil {
+		return nil, err
+	}
+
+	days := []Day{}
+	for _, date := range dates {
+
+		index := utils.GetMenuIndex(date)
+
+		day := Day{
+			Date:       date,
+			LunchName:  lunches[index],
+			DinnerName: dinners[index],
+			HasLunch:   user.AlwaysLunch,
+			HasDinner:  user.AlwaysDinner,
+			Locked:     s.policy.IsLocked(date),
+		}
+
+		for _, reserve := range reserves {
+
+			if reserve.Date.Format("2006-01-02") == date.Format("2006-01-02") {
+
+				day.HasLunch = reserve.HasLunch
+				day.HasDinner = reserve.HasDinner
+				day.Reserved = true
+				break
+			}
+		}
+
+		days = append(days, day)
+	}
+
+	return days, nil
+}
+
+// Menu returns the dish names of the rotation, with default names for empty slots.
+func (s *Service) Menu() ([model.MenuSlots]string, [model.MenuSlots]string, error) {
+
+	lunches := [model.MenuSlots]string{}
+	dinners := [model.MenuSlots]string{}
+
+	meals, err := s.store.ListMeals()
+	if err != nil {
+		return lunches, dinners, err
+	}
+
+	for i := range lunches {
+		lunches[i] = "نهار"
+		dinners[i] = "شام"
+	}
+
+	for _, meal := range meals {
+		if meal.ID < 1 || meal.ID > model.MenuSlots {
+			continue
+		}
+
+		if meal.Lunch != nil {
+			lunches[meal.ID-1] = *meal.Lunch
+		}
+
+		if meal.Dinner != nil {
+			dinners[meal.ID-1] = *meal.Dinner
+		}
+	}
+
+	return lunches, dinners, nil
+}
+
+// update checks the date can be changed, applies change to its reserve and saves it, in a transaction locking the reserves of the user.
+func (s *Service) update(user model.User, date time.Time, change func(reserve *model.Reserve) error) (model.Reserve, error) {
+
+	if err := s.CheckEditable(date); err != nil {
+		return model.Reserve{}, err
+	}
+
+	var reserve model.Reserve
+	var created bool
+
+	// the reserve is read and saved by one writer at a time, so concurrent changes aren't lost
+	err := s.store.Transaction(func(store storage.Store) error {
+
+		if err := store.LockReserves(user.ID); err != nil {
+			return err
+		}
+
+		var err error
+		reserve, err = NewService(store, s.policy, s.source).Find(user, date)
+		if err != nil {
+			return err
+		}
+
+		if err := change(&reserve); err != nil {
+			return err
+		}
+
+		created = reserve.ID == 0
+
+		return store.SaveReserve(&reserve)
+	})
+	if err != nil {
+		return reserve, err
+	}
+
+	s.published(reserve, created)
+
+	return reserve, nil
+}
+
+func (s *Service) published(reserve model.Reserve, created bool) {
+	metrics.ReserveChanges.WithLabelValues(s.source).Inc()
+	events.PublishReserve(reserve, created)
+}
@@ -1,441 +1,508 @@
 package telegramBot
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
 	"log"
-	"luncher/handler/database"
+	"luncher/handler/config"
+	"luncher/handler/events"
+	"luncher/handler/messenger"
+	"luncher/handler/metrics"
 	model "luncher/handler/models"
+	"luncher/handler/outbox"
+	"luncher/handler/storage"
 	"luncher/handler/utils"
+	"luncher/service/reservation"
+	"net/http"
+	"net/url"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
+	"github.com/gin-gonic/gin"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
-	"gorm.io/gorm"
 	Jalaali "github.com/jalaali/go-jalaali"
 )
 
-var telegramBot *tgbotapi.BotAPI
-var memCache *utils.Store
-
-func Reminder() {
+// maxPendingUpdates limits the updates of one user waiting to be handled, like a user flooding taps.
+const maxPendingUpdates = 20
 
-	var lastSent time.Time
-
-	for {
-		now := time.Now()
+// the settings toggled by the buttons of /setting
+const (
+	settingAlwaysLunch  = "always_lunch"
+	settingAlwaysDinner = "always_dinner"
+)
 
-		// Wait until Friday at 15:00
-		if now.Weekday() == time.Friday && now.Hour() == 15 && lastSent.Add(24*time.Hour).Before(now) {
-			users := []model.User{}
+var telegramBot *tgbotapi.BotAPI
+var bot messenger.Messenger
+var conf *config.Config
+var store storage.Store
+var lastMessages *utils.Cache[int64, int]
+var router *Router
+var updateQueue *utils.UserRequestQueue
 
-			db := database.Connection().Conn
-			db.Table("users").Find(&users)
+// messageQueue sends bulk messages within the telegram rate limits
+var messageQueue *outbox.Outbox
 
-			for _, user := range users {
-				messageStr := strings.Builder{}
-				messageStr.WriteString("لیست غذا یادت نره 👋\n\n")
-				messageStr.WriteString("یکبار دیگه از منو، دکمه انتخاب رو بزنید تا لیست بروزرسانی شود و بعد انتخاب کنید.")
+// pollingDone is closed when polling has stopped
+var pollingDone chan struct{}
 
-				msg := tgbotapi.NewMessage(user.TelegramID, messageStr.String())
+// SendReminders sends the weekly reminder to every user, it's run by the scheduler.
+func SendReminders(ctx context.Context, scheduledAt time.Time) error {
 
-				_, err := telegramBot.Send(msg)
-				if err != nil {
-					log.Println("show meal list error", err)
-					continue
-				}
-			}
+	users, err := store.ListUsers()
+	if err != nil {
+		return err
+	}
 
-			lastSent = now
+	messageStr := strings.Builder{}
+	messageStr.WriteString("لیست غذا یادت نره 👋\n\n")
+	messageStr.WriteString("یکبار دیگه از منو، دکمه انتخاب رو بزنید تا لیست بروزرسانی شود و بعد انتخاب کنید.")
 
-			log.Println("Reminders sent!")
+	// users who blocked the bot are skipped, the outbox sends the rest within the telegram rate limits
+	reminders := []messenger.Message{}
+	for _, user := range users {
+		if user.UnreachableAt == nil {
+			reminders = append(reminders, messenger.NewMessage(user.TelegramID, messageStr.String()))
 		}
+	}
 
-		// Sleep and check again in 1 hour
-		time.Sleep(1 * time.Hour)
+	if err := messageQueue.Enqueue(reminders...); err != nil {
+		return err
 	}
+
+	log.Printf("%d reminders queued", len(reminders))
+
+	return nil
+}
+
+// RunOutbox sends the queued messages until ctx is done, it must run on the leader only.
+func RunOutbox(ctx context.Context) {
+	messageQueue.Run(ctx)
 }
 
-func LoadBot() {
+// LoadBot connects to telegram with the token of the config, the config and store are kept for the handlers.
+func LoadBot(config *config.Config, botStore storage.Store) {
+
+	conf = config
+	store = botStore
 
 	// Replace with your Bot's token
-	botToken := utils.Getenv("TELEGRAM_BOT_TOKEN", "")
+	botToken := conf.Telegram.Token
+
+	transport := http.DefaultTransport
+	if conf.Telegram.APIURL != "" {
+		transport = apiURLTransport(conf.Telegram.APIURL, transport)
+	}
+
+	client := &http.Client{Transport: metrics.TelegramTransport(transport)}
 
-	bot, err := tgbotapi.NewBotAPI(botToken)
+	api, err := tgbotapi.NewBotAPIWithClient(botToken, client)
 	if err != nil {
 		log.Panic(err)
 	}
 
-	// bot.Debug = true
-	log.Printf("Authorized on account %s", bot.Self.UserName)
+	// api.Debug = true
+	log.Printf("Authorized on account %s", api.Self.UserName)
 
-	telegramBot = bot
+	telegramBot = api
+	bot = messenger.NewTelegram(api)
+	messageQueue = outbox.New(store, bot)
 }
 
-func StartBotServer() {
-
-	// Handle updates (messages, button presses, etc.)
-	u := tgbotapi.NewUpdate(0)
-	u.Timeout = 60
-	updates, _ := telegramBot.GetUpdatesChan(u)
-
-	db := database.Connection().Conn
+// apiURLTransport sends the bot API requests to apiURL instead of api.telegram.org,
+// tgbotapi has the endpoint as a constant.
+func apiURLTransport(apiURL string, next http.RoundTripper) http.RoundTripper {
 
-	// setup memCache
-	memCache = utils.MemCache()
-	go memCache.Cleanup()
-
-	// Loop to listen for incoming messages or button presses
-	for update := range updates {
-
-		if update.Message != nil {
-
-			if _, found := memCache.Get(fmt.Sprintf("%s_set_meal", update.Message.From.UserName)); found {
+	base, err := url.Parse(apiURL)
+	if err != nil {
+		log.Panic("invalid TELEGRAM_API_URL ", err)
+	}
 
-				handleSetMealName(update, db)
-				continue
-			}
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
 
-			if update.Message.Text == "/setList" {
-				if !isAdmin(update.Message.From.UserName) {
+		req = req.Clone(req.Context())
+		req.URL.Scheme = base.Scheme
+		req.URL.Host = base.Host
+		req.URL.Path = strings.TrimSuffix(base.Path, "/") + req.URL.Path
+		req.Host = base.Host
 
-					telegramBot.Send(tgbotapi.NewMessage(update.Message.Chat.ID, "شما دسترسی ندارید."))
+		return next.RoundTrip(req)
+	})
+}
 
-					log.Printf("Unauthorized access - username: %s", update.Message.From.UserName)
-					continue
-				} else {
+type roundTripperFunc func(*http.Request) (*http.Response, error)
 
-					showMealSetFrom(update.Message.Chat.ID)
-				}
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
 
-				continue
-			}
+// SetMessenger replaces the messenger used by the handlers, like a messenger.Recorder in tests.
+func SetMessenger(m messenger.Messenger) {
+	bot = m
+	messageQueue = outbox.New(store, m)
+}
 
-			if update.Message.Text == "/getCounts" {
-				showCounts(update, db)
+// StartBotServer starts receiving updates, by long polling or by a webhook on the given gin engine.
+// Polling and the cache cleanup stop when ctx is done, see Shutdown.
+func StartBotServer(ctx context.Context, app *gin.Engine) {
 
-				continue
-			}
+	// the last meal selection message of each chat, replaced on the next button press
+	lastMessages = utils.NewCache[int64, int](utils.CacheOptions{MaxSize: 10000, TTL: 1 * time.Minute})
+	go lastMessages.Cleanup(ctx)
 
-			if update.Message.Text == "/getReserves" {
+	go expireConversations(ctx)
 
-				showReservesDetails(update, db)
-				continue
-			}
+	router = newRouter()
 
-			// Start command to show the meal selection form
-			if update.Message.Text == "/start" {
+	updateQueue = utils.NewUserRequestQueue(conf.Telegram.Workers, maxPendingUpdates)
 
-				createUser(update, db)
+	mode := conf.Telegram.Mode
+	botMode.Store(mode)
+	startedAt.Store(time.Now().UnixNano())
 
-				helpStr := helpMessageCreator(update)
+	if mode == "webhook" {
 
-				telegramBot.Send(tgbotapi.NewMessage(update.Message.Chat.ID, helpStr.String()))
-			}
+		startWebhook(app)
+		return
+	}
 
-			user := findUser(db, update.Message.Chat.ID)
+	pollingDone = make(chan struct{})
+	go func() {
+		defer close(pollingDone)
+		startPolling(ctx)
+	}()
+}
 
-			if user.ID == 0 {
+// Shutdown waits for polling to stop and the queued updates to be handled, or for ctx to be done.
+func Shutdown(ctx context.Context) error {
 
-				createUser(update, db)
-			}
+	done := make(chan struct{})
+	go func() {
+		if pollingDone != nil {
+			<-pollingDone
+		}
+		updateQueue.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
 
-			if update.Message.Text == "/select" {
+type updatesResult struct {
+	updates []tgbotapi.Update
+	err     error
+}
 
-				showMealSelectionForm(user, update.Message.Chat.ID)
-			}
+func startPolling(ctx context.Context) {
 
-			if update.Message.Text == "/help" {
+	// getUpdates doesn't work while a webhook is set
+	_, err := telegramBot.RemoveWebhook()
+	if err != nil {
+		log.Println("remove webhook error", err)
+	}
 
-				helpStr := helpMessageCreator(update)
+	// Handle updates (messages, button presses, etc.)
+	u := tgbotapi.NewUpdate(0)
+	u.Timeout = 60
 
-				telegramBot.Send(tgbotapi.NewMessage(update.Message.Chat.ID, helpStr.String()))
+	// Loop to listen for incoming messages or button presses
+	for {
+		// a long poll can't be cancelled, so stop waiting for it instead.
+		// its updates are not confirmed and telegram sends them again after a restart.
+		result := make(chan updatesResult, 1)
+		go func() {
+			updates, err := telegramBot.GetUpdates(u)
+			result <- updatesResult{updates, err}
+		}()
+
+		var updates []tgbotapi.Update
+		select {
+		case <-ctx.Done():
+			log.Println("Polling stopped")
+			return
+		case got := <-result:
+			updates = got.updates
+			if got.err != nil {
+				log.Println("get updates error", got.err)
+				time.Sleep(3 * time.Second)
+				continue
 			}
+		}
 
-			if update.Message.Text == "/setting" {
+		lastUpdatesAt.Store(time.Now().UnixNano())
 
-				showSettingForm(user, update.Message.Chat.ID)
+		for _, update := range updates {
+			if update.UpdateID >= u.Offset {
+				u.Offset = update.UpdateID + 1
+				handleUpdate(update)
 			}
-
 		}
+	}
+}
 
-		// Handle button presses (callback queries)
-		if update.CallbackQuery != nil {
+// handleUpdate queues one update, received by polling or webhook.
+// Updates run concurrently, except the updates of one user that run in order.
+func handleUpdate(update tgbotapi.Update) {
 
-			if strings.HasPrefix(update.CallbackQuery.Data, "...") {
-				continue
-			}
+	c := &Context{Update: update, Store: store}
 
-			if strings.HasPrefix(update.CallbackQuery.Data, "set_lunch_") ||
-				strings.HasPrefix(update.CallbackQuery.Data, "set_dinner_") {
+	userID := strconv.FormatInt(c.ChatID(), 10)
+	if from := c.From(); from != nil {
+		userID = strconv.Itoa(from.ID)
+	}
 
-				handleSetMealList(update)
-				continue
-			}
+	accepted := updateQueue.Process(userID, func() { router.Handle(c) })
+	if !accepted {
+		log.Printf("dropped update %d, user %s has too many pending updates", update.UpdateID, userID)
+	}
+}
 
-			//find user id
-			user := findUser(db, int64(update.CallbackQuery.From.ID))
+func showHelp(c *Context) {
 
-			if user.ID == 0 {
-				telegramBot.Send(tgbotapi.NewMessage(update.Message.Chat.ID, "خطا در ارتباط با دیتابیس"))
-				continue
-			}
+	helpStr := helpMessageCreator(c.Username())
 
-			if strings.HasPrefix(update.CallbackQuery.Data, "setting_") {
+	bot.SendMessage(messenger.NewMessage(c.ChatID(), helpStr.String()))
+}
 
-				if update.CallbackQuery.Data == "setting_always_lunch" {
+func handleSettingPress(c *Context) {
 
-					user.AlwaysLunch = !user.AlwaysLunch
-					db.Save(&user)
-				}
+	user := c.User
 
-				if update.CallbackQuery.Data == "setting_always_dinner" {
+	if c.Callback.Arg(0) == settingAlwaysLunch {
 
-					user.AlwaysDinner = !user.AlwaysDinner
-					db.Save(&user)
-				}
+		user.AlwaysLunch = !user.AlwaysLunch
+		c.Store.SaveUser(&user)
+	}
 
-				telegramBot.AnswerCallbackQuery(tgbotapi.NewCallback(update.CallbackQuery.ID, "تغییر کرد"))
+	if c.Callback.Arg(0) == settingAlwaysDinner {
 
-				showSettingForm(user, int64(update.CallbackQuery.From.ID))
+		user.AlwaysDinner = !user.AlwaysDinner
+		c.Store.SaveUser(&user)
+	}
 
-				// remove last setting form
-				_, err := telegramBot.DeleteMessage(tgbotapi.DeleteMessageConfig{
-					ChatID:    int64(update.CallbackQuery.From.ID),
-					MessageID: update.CallbackQuery.Message.MessageID,
-				})
+	events.Publish(events.SettingsChanged, user)
 
-				if err != nil {
-					log.Println(err)
-				}
+	bot.AnswerCallback(c.Update.CallbackQuery.ID, "تغییر کرد")
 
-				continue
-			}
+	showSettingForm(user, int64(c.Update.CallbackQuery.From.ID))
 
-			handleButtonPress(user, update.CallbackQuery)
-		}
+	// remove last setting form
+	err := bot.DeleteMessage(int64(c.Update.CallbackQuery.From.ID), c.Update.CallbackQuery.Message.MessageID)
+
+	if err != nil {
+		log.Println(err)
 	}
 }
 
-func helpMessageCreator(update tgbotapi.Update) strings.Builder {
+// reserveService returns the reservation rules of the config on the given store.
+func reserveService(s storage.Store) *reservation.Service {
+	return reservation.NewService(s, reservation.NewPolicy(conf), "bot")
+}
+
+func helpMessageCreator(username string) strings.Builder {
 	helpStr := strings.Builder{}
 
 	helpStr.WriteString("راهنما:\n")
 	helpStr.WriteString("/select - انتخاب غذا\n")
-	helpStr.WriteString("\t\t\tوعده های غذایی دو هفته‌ی آینده نمایش داده میشود و قابل اضافه و حذف شدن هستند. ( توجه داشته باشید که وعده هر روز نهایتا تا ساعت ۲۰ روز قبل، قابل تغییر میباشد)\n")
+	helpStr.WriteString("\t\t\tوعده های غذایی دو هفته‌ی آینده نمایش داده میشود و قابل اضافه و حذف شدن هستند. ( توجه داشته باشید که وعده هر روز نهایتا تا ساعت " + reservation.NewPolicy(conf).CutoffClock() + " روز قبل، قابل تغییر میباشد)\n")
+	helpStr.WriteString("/app - انتخاب غذا در مینی اپ\n")
+	helpStr.WriteString("/calendar - لینک تقویم غذاهای انتخاب شده\n")
 	helpStr.WriteString("/setting - تنظیمات\n")
 	helpStr.WriteString("\t\t\tاگر گزینه همیشه نهار یا همیشه شام را انتخاب کنید، در همه روز های هفته، آن وعده غذایی انتخاب شده و نیاز به انتخاب جداگانه‌ی هر روز نمیباشد.\n")
 
-	if isAdmin(update.Message.From.UserName) {
+	if isAdmin(username) {
 
 		helpStr.WriteString("\n\n")
 		helpStr.WriteString("تنظیمات مخصوص ادمین:\n")
 		helpStr.WriteString("/setList - ویرایش لیست غذا دو هفته ای\n")
 		helpStr.WriteString("/getCounts - نمایش تعداد امروز\n")
 		helpStr.WriteString("/getReserves - نمایش جزئیات دو هفته آینده\n")
+		helpStr.WriteString("/jobs - کارهای زمان‌بندی شده\n")
+		helpStr.WriteString("/cancel - لغو عملیات در حال انجام\n")
 	}
 	return helpStr
 }
 
-func createUser(update tgbotapi.Update, db *gorm.DB) model.User {
-	user := model.User{
-		TelegramID: update.Message.Chat.ID,
-		Username:   update.Message.Chat.UserName,
-		Name:       update.Message.Chat.FirstName,
-	}
+func showCounts(c *Context) {
 
-	var userDB model.User
-	db.Where("telegram_id = ?", user.TelegramID).First(&userDB)
-	if userDB.ID == 0 {
-		db.Create(&user)
-	}
+	noop := NewCallback(ActionNoop)
 
-	return user
-}
+	keyboard := keyboard{}
+	keyboard.Row(
+		keyboard.Button("شام", noop),
+		keyboard.Button("نهار", noop),
+		messenger.NewSwitchButton("*", "..."),
+	)
 
-func showCounts(update tgbotapi.Update, db *gorm.DB) {
-	if !isAdmin(update.Message.From.UserName) {
+	policy := reservation.NewPolicy(conf)
+	today := policy.Today()
 
-		telegramBot.Send(tgbotapi.NewMessage(update.Message.Chat.ID, "شما دسترسی ندارید."))
-
-		log.Printf("Unauthorized access - username: %s", update.Message.From.UserName)
+	counts, err := reserveService(c.Store).CountsForRange(today, policy.LastDay(today))
+	if err != nil {
+		log.Println("count reserves error", err)
 		return
 	}
 
-	buttons := [][]tgbotapi.InlineKeyboardButton{
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("شام", "..."),
-			tgbotapi.NewInlineKeyboardButtonData("نهار", "..."),
-			tgbotapi.NewInlineKeyboardButtonSwitch("*", "..."),
-		),
-	}
-
-	var next14DaysMeals []model.Meal
-	db.Order("id").Find(&next14DaysMeals)
-
-	today := time.Now()
-
-	for i := 0; i < 14; i++ {
-
-		var lunchUsersCounts int64
+	for _, count := range counts {
 
-		date := today.AddDate(0, 0, i).Truncate(24 * time.Hour)
-
-		weekDay := date.Weekday()
-		faDayNumber := utils.GetJalaliWeekDayNumber(weekDay)
+		faDayNumber := utils.GetJalaliWeekDayNumber(count.Date.Weekday())
 		faDayName := utils.GetFaDayNameByNumber(faDayNumber)
 
-		_, jMonth, jDay, _ := Jalaali.ToJalaali(date.Year(), date.Month(), date.Day())
+		_, jMonth, jDay, _ := Jalaali.ToJalaali(count.Date.Year(), count.Date.Month(), count.Date.Day())
 		key := fmt.Sprintf("%s (%d\u200c%s)", faDayName, jDay, jMonth)
 
-		dataString := date.Format("2006-01-02")
-
-		db.Model(&model.User{}).
-			Where("(always_lunch = ? AND NOT EXISTS(SELECT user_id FROM reserves WHERE reserves.user_id = users.id and date = ?)) OR id IN (SELECT user_id FROM reserves WHERE date = ? AND has_lunch = ?)", true, dataString, dataString, true).
-			Count(&lunchUsersCounts)
-
-		var dinnerUsersCount int64
-		db.Model(&model.User{}).
-			Where("(always_dinner = ? AND NOT EXISTS(SELECT user_id FROM reserves WHERE reserves.user_id = users.id and date = ?)) OR id IN (SELECT user_id FROM reserves WHERE date = ? AND has_dinner = ?)", true, dataString, dataString, true).
-			Count(&dinnerUsersCount)
-
-		rowButton := tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("%d", dinnerUsersCount), "..."),
-			tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("%d", lunchUsersCounts), "..."),
-			tgbotapi.NewInlineKeyboardButtonData(key, "..."),
+		keyboard.Row(
+			keyboard.Button(fmt.Sprintf("%d", count.Dinner), noop),
+			keyboard.Button(fmt.Sprintf("%d", count.Lunch), noop),
+			keyboard.Button(key, noop),
 		)
-
-		buttons = append(buttons, rowButton)
 	}
 
-	inlineKeyboard := tgbotapi.NewInlineKeyboardMarkup(buttons...)
+	if err := keyboard.Err(); err != nil {
+		log.Println("show counts keyboard error", err)
+		return
+	}
 
-	msg := tgbotapi.NewMessage(int64(update.Message.From.ID), "لیست")
-	msg.ReplyMarkup = inlineKeyboard
+	msg := messenger.NewMessage(int64(c.Update.Message.From.ID), "لیست")
+	msg.Keyboard = keyboard.Rows()
 	msg.DisableNotification = true
-	_, err := telegramBot.Send(msg)
+	_, err = bot.SendMessage(msg)
 	if err != nil {
 		log.Println("show meal list error", err)
 		return
 	}
 }
 
-func showReservesDetails(update tgbotapi.Update, db *gorm.DB) {
-	if !isAdmin(update.Message.From.UserName) {
+func showReservesDetails(c *Context) {
 
-		telegramBot.Send(tgbotapi.NewMessage(update.Message.Chat.ID, "شما دسترسی ندارید."))
+	policy := reservation.NewPolicy(conf)
+	today := policy.Today()
 
-		log.Printf("Unauthorized access - username: %s", update.Message.From.UserName)
+	days, err := reserveService(c.Store).UsersForRange(today, policy.LastDay(today))
+	if err != nil {
+		log.Println("find reserves error", err)
 		return
 	}
 
 	var statsMessage strings.Builder
-	today := time.Now()
-
-	for i := 0; i < 14; i++ {
-		var lunchUsers []model.User
-
-		date := today.AddDate(0, 0, i).Truncate(24 * time.Hour).Format("2006-01-02")
 
-		db.Model(&model.User{}).
-			Where("(always_lunch = ? AND NOT EXISTS(SELECT user_id FROM reserves WHERE reserves.user_id = users.id and date = ?)) OR id IN (SELECT user_id FROM reserves WHERE date = ? AND has_lunch = ?)", true, date, date, true).
-			Find(&lunchUsers)
-
-		var dinnerUsers []model.User
-		db.Model(&model.User{}).
-			Where("(always_dinner = ? AND NOT EXISTS(SELECT user_id FROM reserves WHERE reserves.user_id = users.id and date = ?)) OR id IN (SELECT user_id FROM reserves WHERE date = ? AND has_dinner = ?)", true, date, date, true).
-			Find(&dinnerUsers)
+	for _, day := range days {
 
 		lunchUsernames := []string{}
-		for _, user := range lunchUsers {
+		for _, user := range day.Lunch {
 			userLink := fmt.Sprintf(`<a href="tg://user?id=%d">%s</a>`, user.TelegramID, user.Name)
 			lunchUsernames = append(lunchUsernames, userLink)
 		}
 
 		dinnerUsernames := []string{}
-		for _, user := range dinnerUsers {
+		for _, user := range day.Dinner {
 			userLink := fmt.Sprintf(`<a href="tg://user?id=%d">%s</a>`, user.TelegramID, user.Name)
 			dinnerUsernames = append(dinnerUsernames, userLink)
 		}
 
-		Date := today.AddDate(0, 0, i)
-
-		jalaliDateYear, jalaliDateMonth, jalaliDateDay, _ := Jalaali.ToJalaali(Date.Year(), Date.Month(), Date.Day())
+		jalaliDateYear, jalaliDateMonth, jalaliDateDay, _ := Jalaali.ToJalaali(day.Date.Year(), day.Date.Month(), day.Date.Day())
 
 		statsMessage.WriteString(fmt.Sprintf(
 			"%s\n\nlunch: %d\n%s\n\ndinner: %d\n%s\n\n----------\n",
 
 			fmt.Sprintf("%d/%d/%d", jalaliDateYear, jalaliDateMonth, jalaliDateDay),
-			len(lunchUsers),
+			len(day.Lunch),
 			strings.Join(lunchUsernames, "\n"),
-			len(dinnerUsers),
+			len(day.Dinner),
 			strings.Join(dinnerUsernames, "\n"),
 		))
 	}
-	msg := tgbotapi.NewMessage(update.Message.Chat.ID, statsMessage.String())
+	msg := messenger.NewMessage(c.ChatID(), statsMessage.String())
 	msg.ParseMode = "HTML"
-	telegramBot.Send(msg)
+	bot.SendMessage(msg)
+}
+
+// setMealWizard asks an admin for the dish name after a set meal button press.
+var setMealWizard = &Wizard{
+	Name:    "set_meal",
+	Timeout: 5 * time.Minute,
+	Steps:   map[string]Step{"name": handleSetMealName},
 }
 
-func handleSetMealName(update tgbotapi.Update, db *gorm.DB) {
-	mealData, _ := memCache.Get(fmt.Sprintf("%s_set_meal", update.Message.From.UserName))
-	mealIDString := mealData.(map[string]string)["mealID"]
-	mealType := mealData.(map[string]string)["mealType"]
+func handleSetMealName(c *Context, conversation *model.Conversation) string {
+	update := c.Update
 
-	mealID, _ := strconv.Atoi(mealIDString)
+	mealID, _ := strconv.Atoi(conversation.Data["mealID"])
+	mealType := conversation.Data["mealType"]
 
-	meal := model.Meal{
-		ID: uint(mealID),
+	name := strings.TrimSpace(update.Message.Text)
+	if name == "" || utf8.RuneCountInString(name) > model.MealNameMaxLength {
+		bot.SendMessage(messenger.NewMessage(update.Message.Chat.ID, fmt.Sprintf("نام غذا باید حداکثر %d حرف باشد، دوباره وارد کنید یا /cancel", model.MealNameMaxLength)))
+		return conversation.Step
 	}
 
-	db.First(&meal)
+	meal, err := c.Store.FindMeal(uint(mealID))
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		log.Println("find meal error", err)
+		return ""
+	}
+	meal.ID = uint(mealID)
 
 	if mealType == "lunch" {
-		meal.Lunch = &update.Message.Text
+		meal.Lunch = &name
 	} else if mealType == "dinner" {
-		meal.Dinner = &update.Message.Text
+		meal.Dinner = &name
 	}
 
-	db.Save(&meal)
+	if err := c.Store.SaveMeals(meal); err != nil {
+		log.Println("save meal error", err)
+		return ""
+	}
+	events.Publish(events.MenuChanged, meal)
 
-	telegramBot.Send(tgbotapi.NewMessage(update.Message.Chat.ID, "بروزرسانی شد."))
-	memCache.Delete(fmt.Sprintf("%s_set_meal", update.Message.From.UserName))
+	bot.SendMessage(messenger.NewMessage(update.Message.Chat.ID, "بروزرسانی شد."))
 
 	showMealSetFrom(int64(update.Message.Chat.ID))
-}
 
-func handleSetMealList(update tgbotapi.Update) {
-	if !isAdmin(update.CallbackQuery.From.UserName) {
+	return ""
+}
 
-		telegramBot.Send(tgbotapi.NewMessage(update.CallbackQuery.Message.Chat.ID, "شما دسترسی ندارید."))
+func handleSetMealList(c *Context) {
+	update := c.Update
 
-		log.Printf("Unauthorized access - username: %s", update.CallbackQuery.From.UserName)
+	mealID, err := c.Callback.Int(0)
+	if err != nil {
+		handleInvalidCallback(c)
 		return
 	}
 
-	mealID := strings.Split(update.CallbackQuery.Data, "_")[2]
-	mealID = strings.Trim(mealID, " ")
-
-	mealType := strings.Split(update.CallbackQuery.Data, "_")[1]
-	mealType = strings.Trim(mealType, " ")
-
-	memCacheData := map[string]string{
-		"mealID":   mealID,
-		"mealType": mealType,
+	mealType, err := c.Callback.Meal(1)
+	if err != nil {
+		handleInvalidCallback(c)
+		return
 	}
 
-	memCache.Set(fmt.Sprintf("%s_set_meal", update.CallbackQuery.From.UserName), memCacheData, 30*time.Second)
+	err = setMealWizard.Start(c, "name", map[string]string{
+		"mealID":   strconv.Itoa(mealID),
+		"mealType": string(mealType),
+	})
+	if err != nil {
+		log.Println("start set meal error", err)
+		return
+	}
 
-	telegramBot.Send(tgbotapi.NewMessage(update.CallbackQuery.Message.Chat.ID, fmt.Sprintf("Enter %s for day %s:", mealType, mealID)))
+	bot.SendMessage(messenger.NewMessage(update.CallbackQuery.Message.Chat.ID, fmt.Sprintf("Enter %s for day %d, or /cancel:", mealType, mealID)))
 }
 
-func findUser(db *gorm.DB, id int64) model.User {
-	user := model.User{}
+func findUser(store storage.Store, id int64) model.User {
 
-	err := db.Model(&model.User{}).Where("telegram_id = ?", id).First(&user)
-	if err.Error != nil {
-		log.Println(err.Error)
+	user, err := store.FindUser(id)
+	if err != nil {
+		log.Println(err)
 	}
 
 	return user
@@ -444,83 +511,61 @@ func findUser(db *gorm.DB, id int64) model.User {
 // Show the meal selection form with inline buttons
 func showMealSelectionForm(user model.User, chatID int64) {
 
-	buttons := [][]tgbotapi.InlineKeyboardButton{
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("انتخاب همه شام ها", "all_dinner"),
-			tgbotapi.NewInlineKeyboardButtonData("انتخاب همه نهار ها", "all_lunch"),
-			tgbotapi.NewInlineKeyboardButtonSwitch("*", "all"),
-		),
-	}
-
-	var next14DaysReserves []model.Reserve
-	db := database.Connection().Conn
-	db.Where("user_id = ? AND date >= ?", user.ID, time.Now().Truncate(24*time.Hour)).Find(&next14DaysReserves)
+	keyboard := keyboard{}
+	keyboard.Row(
+		keyboard.Button("انتخاب همه شام ها", NewCallback(ActionSelectAll, string(reservation.Dinner))),
+		keyboard.Button("انتخاب همه نهار ها", NewCallback(ActionSelectAll, string(reservation.Lunch))),
+		messenger.NewSwitchButton("*", "all"),
+	)
 
-	lunchesList, dinnersList := generateMeals()
-
-	for i := 0; i < 14; i++ {
-
-		date := time.Now().AddDate(0, 0, i)
-
-		// find week number of year
-		weekNumber := utils.GetJalaliWeekNumber(date)
-		weekDay := date.Weekday()
-		faDayNumber := utils.GetJalaliWeekDayNumber(weekDay)
-		faDayName := utils.GetFaDayName(weekDay)
-
-		index := int(weekNumber*7+int(faDayNumber)) - 1
-
-		// Check if the user has already selected a meal for this day
-		selectedMeal := model.Reserve{
-			HasDinner: user.AlwaysDinner,
-			HasLunch:  user.AlwaysLunch,
-		}
-
-		for _, reserve := range next14DaysReserves {
+	days, err := reserveService(store).Days(user)
+	if err != nil {
+		log.Println("load reserves error", err)
+		return
+	}
 
-			if reserve.Date.Format("2006-01-02") == date.Format("2006-01-02") {
+	for _, day := range days {
 
-				selectedMeal.HasDinner = reserve.HasDinner
-				selectedMeal.HasLunch = reserve.HasLunch
-				break
-			}
-		}
+		faDayName := utils.GetFaDayName(day.Date.Weekday())
 
-		_, jMonth, jDay, _ := Jalaali.ToJalaali(date.Year(), date.Month(), date.Day())
+		_, jMonth, jDay, _ := Jalaali.ToJalaali(day.Date.Year(), day.Date.Month(), day.Date.Day())
 		key := fmt.Sprintf("%s (%d\u200c%s)", faDayName, jDay, jMonth)
 
-		rowButton := tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData(getButtonText(dinnersList[index], selectedMeal.HasDinner), fmt.Sprintf("%s_dinner", date.Format("2006-01-02"))),
-			tgbotapi.NewInlineKeyboardButtonData(getButtonText(lunchesList[index], selectedMeal.HasLunch), fmt.Sprintf("%s_lunch", date.Format("2006-01-02"))),
-			tgbotapi.NewInlineKeyboardButtonData(key, date.Format("2006-01-02")),
+		dateString := day.Date.Format("2006-01-02")
+
+		keyboard.Row(
+			keyboard.Button(getButtonText(day.DinnerName, day.HasDinner), NewCallback(ActionToggleMeal, dateString, string(reservation.Dinner))),
+			keyboard.Button(getButtonText(day.LunchName, day.HasLunch), NewCallback(ActionToggleMeal, dateString, string(reservation.Lunch))),
+			keyboard.Button(key, NewCallback(ActionNoop)),
 		)
+	}
 
-		buttons = append(buttons, rowButton)
+	if err := keyboard.Err(); err != nil {
+		log.Println("show meal keyboard error", err)
+		return
 	}
 
 	// Create inline keyboard buttons for each day and meal (lunch and dinner)
-	inlineKeyboard := tgbotapi.NewInlineKeyboardMarkup(buttons...)
-
-	msg := tgbotapi.NewMessage(chatID, "Please select your meal preferences for each day.")
-	msg.ReplyMarkup = inlineKeyboard
+	msg := messenger.NewMessage(chatID, "Please select your meal preferences for each day.")
+	msg.Keyboard = keyboard.Rows()
 	msg.DisableNotification = true
-	message, err := telegramBot.Send(msg)
+	messageID, err := bot.SendMessage(msg)
 	if err != nil {
 		log.Println("show meal error", err)
 		return
 	}
 
-	memCacheKey := fmt.Sprintf("user_%d_last_message", chatID)
-	memCache.Set(memCacheKey, message.MessageID, 1*time.Minute)
+	lastMessages.Set(chatID, messageID)
 }
 
 func showMealSetFrom(chatID int64) {
 
-	buttons := [][]tgbotapi.InlineKeyboardButton{}
+	keyboard := keyboard{}
 
-	var next14DaysMeals []model.Meal
-	db := database.Connection().Conn
-	db.Order("id").Find(&next14DaysMeals)
+	next14DaysMeals, err := store.ListMeals()
+	if err != nil {
+		log.Println("list meals error", err)
+	}
 
 	for i := 1; i < 15; i++ {
 
@@ -548,235 +593,138 @@ func showMealSetFrom(chatID int64) {
 			weekNumber = i - 7
 		}
 
-		rowButton := tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData(*dayMeal.Dinner, fmt.Sprintf("set_dinner_%d", i)),
-			tgbotapi.NewInlineKeyboardButtonData(*dayMeal.Lunch, fmt.Sprintf("set_lunch_%d", i)),
-			tgbotapi.NewInlineKeyboardButtonData(utils.GetFaDayNameByNumber(weekNumber), "d"),
+		keyboard.Row(
+			keyboard.Button(*dayMeal.Dinner, NewCallback(ActionSetMeal, strconv.Itoa(i), string(reservation.Dinner))),
+			keyboard.Button(*dayMeal.Lunch, NewCallback(ActionSetMeal, strconv.Itoa(i), string(reservation.Lunch))),
+			keyboard.Button(utils.GetFaDayNameByNumber(weekNumber), NewCallback(ActionNoop)),
 		)
-
-		buttons = append(buttons, rowButton)
 	}
 
-	inlineKeyboard := tgbotapi.NewInlineKeyboardMarkup(buttons...)
+	if err := keyboard.Err(); err != nil {
+		log.Println("show meal list keyboard error", err)
+		return
+	}
 
-	msg := tgbotapi.NewMessage(chatID, "انتخاب کنید.")
-	msg.ReplyMarkup = inlineKeyboard
+	msg := messenger.NewMessage(chatID, "انتخاب کنید.")
+	msg.Keyboard = keyboard.Rows()
 	msg.DisableNotification = true
-	_, err := telegramBot.Send(msg)
+	_, err = bot.SendMessage(msg)
 	if err != nil {
 		log.Println("show meal list error", err)
 		return
 	}
 }
 
-func showSettingForm(user model.User, chatID int64) {
+// showWebAppButton sends a button that opens the meal selection mini app.
+func showWebAppButton(chatID int64) {
 
-	buttons := [][]tgbotapi.InlineKeyboardButton{
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData(getButtonText("همیشه شام", user.AlwaysDinner), "setting_always_dinner"),
-			tgbotapi.NewInlineKeyboardButtonData(getButtonText("همیشه نهار", user.AlwaysLunch), "setting_always_lunch"),
-		),
+	webAppURL := conf.HTTP.WebAppURL
+	if webAppURL == "" {
+		bot.SendMessage(messenger.NewMessage(chatID, "مینی اپ فعال نیست."))
+		return
 	}
 
-	inlineKeyboard := tgbotapi.NewInlineKeyboardMarkup(buttons...)
+	msg := messenger.NewMessage(chatID, "انتخاب غذا در مینی اپ")
+	msg.Keyboard = [][]messenger.Button{
+		messenger.NewRow(messenger.NewWebAppButton("باز کردن لیست غذا", webAppURL)),
+	}
 
-	msg := tgbotapi.NewMessage(chatID, "تنظیمات کلی")
-	msg.ReplyMarkup = inlineKeyboard
-	msg.DisableNotification = true
-	_, err := telegramBot.Send(msg)
+	_, err := bot.SendMessage(msg)
 	if err != nil {
-		log.Println("show setting error", err)
-		return
+		log.Println("show web app error", err)
 	}
 }
 
-func generateMeals() ([14]string, [14]string) {
-
-	db := database.Connection().Conn
-
-	var meals []model.Meal
-	db.Model(&model.Meal{}).Find(&meals)
-
-	lunches := [14]string{}
-	dinners := [14]string{}
-
-	// fill empty meals
-	for i := 0; i < 14; i++ {
-
-		// check if meal with id = i exists place it
-		for _, m := range meals {
-
-			if m.ID == uint(i+1) {
-
-				if m.Lunch == nil {
-					lunches[i] = "نهار"
-				} else {
-					lunches[i] = *m.Lunch
-				}
-
-				if m.Dinner == nil {
-					dinners[i] = "شام"
-				} else {
-					dinners[i] = *m.Dinner
-				}
-
-				break
-			}
-		}
+func showSettingForm(user model.User, chatID int64) {
 
-		if lunches[i] == "" {
-			lunches[i] = "نهار"
-		}
+	keyboard := keyboard{}
+	keyboard.Row(
+		keyboard.Button(getButtonText("همیشه شام", user.AlwaysDinner), NewCallback(ActionSetting, settingAlwaysDinner)),
+		keyboard.Button(getButtonText("همیشه نهار", user.AlwaysLunch), NewCallback(ActionSetting, settingAlwaysLunch)),
+	)
 
-		if dinners[i] == "" {
-			dinners[i] = "شام"
-		}
+	if err := keyboard.Err(); err != nil {
+		log.Println("show setting keyboard error", err)
+		return
 	}
 
-	return lunches, dinners
+	msg := messenger.NewMessage(chatID, "تنظیمات کلی")
+	msg.Keyboard = keyboard.Rows()
+	msg.DisableNotification = true
+	_, err := bot.SendMessage(msg)
+	if err != nil {
+		log.Println("show setting error", err)
+		return
+	}
 }
 
-// Handle button press events
-func handleButtonPress(user model.User, callback *tgbotapi.CallbackQuery) {
-
-	// Get the user ID and the selected meal option
-	selectedOption := callback.Data
-
-	var isLunch bool
-	var isDinner bool
-
-	if selectedOption == "all" || selectedOption == "all_lunch" || selectedOption == "all_dinner" {
-		for i := 0; i < 14; i++ {
-			date := time.Now().AddDate(0, 0, i).Truncate(24 * time.Hour)
-			db := database.Connection().Conn
-
-			// max edit time is yesterday 17:30
-			maxEditTime := date.AddDate(0, 0, -1).Truncate(24 * time.Hour).Add(17*time.Hour + 30*time.Minute)
-
-			// if date is today and hour pass from 20 in tehran
-			// show error message
-			if time.Now().After(maxEditTime) {
-				continue
-			}
-
-			var reserve model.Reserve
-
-			query := db.Model(&model.Reserve{})
-			query.Where("date = ? ", date)
-			query.Where("user_id = ?", user.ID)
-			err := query.First(&reserve).Error
+// Handle the meal selection button presses
+func handleButtonPress(c *Context) {
 
-			if err != nil && err != gorm.ErrRecordNotFound {
-				log.Println(err)
-				return
-			}
+	user := c.User
+	callback := c.Update.CallbackQuery
 
-			if err == gorm.ErrRecordNotFound {
+	service := reserveService(store)
 
-				reserve = model.Reserve{
-					Date:   date,
-					UserID: user.ID,
-				}
-			}
+	if c.Callback.Action == ActionSelectAll {
 
-			if selectedOption == "all" {
-				// reserve.HasLunch = true
-				// reserve.HasDinner = true
-			} else if selectedOption == "all_lunch" {
-				reserve.HasLunch = true
-			} else if selectedOption == "all_dinner" {
-				reserve.HasDinner = true
-			}
-
-			reserve.UpdateAt = time.Now()
+		meal, err := c.Callback.Meal(0)
+		if err != nil {
+			handleInvalidCallback(c)
+			return
+		}
 
-			db.Save(&reserve)
+		_, err = service.BulkSet(user, meal, true)
+		if err != nil {
+			log.Println(err)
+			return
 		}
 
 		// Send the updated message to the user
-		telegramBot.AnswerCallbackQuery(tgbotapi.NewCallback(callback.ID, "همه انتخاب شدند"))
+		bot.AnswerCallback(callback.ID, "همه انتخاب شدند")
 
 	} else {
 
-		// if end with _lunch or _dinner
-		// split and get date
-		date, err := time.Parse("2006-01-02", selectedOption[:10])
+		date, err := c.Callback.Date(0)
 		if err != nil {
-			log.Println(err)
+			handleInvalidCallback(c)
 			return
 		}
 
-		// max edit time is yesterday 17:30
-		maxEditTime := date.AddDate(0, 0, -1).Truncate(24 * time.Hour).Add(17*time.Hour + 30*time.Minute)
-
-		// if date is today and hour pass from 20 in tehran
-		// show error message
-		if time.Now().After(maxEditTime) {
-			telegramBot.AnswerCallbackQuery(tgbotapi.NewCallback(callback.ID, "زمان تغییر برای این روز به پایان رسیده است"))
+		meal, err := c.Callback.Meal(1)
+		if err != nil {
+			handleInvalidCallback(c)
 			return
 		}
 
-		db := database.Connection().Conn
-
-		var reserve model.Reserve
-
-		query := db.Model(&model.Reserve{})
-		query.Where("date = ? ", date)
-		query.Where("user_id = ?", user.ID)
-		err = query.First(&reserve).Error
-
-		if err != nil && err != gorm.ErrRecordNotFound {
-			log.Println(err)
+		_, err = service.Toggle(user, date, meal)
+		if errors.Is(err, reservation.ErrDeadlinePassed) || errors.Is(err, reservation.ErrOutOfWindow) {
+			bot.AnswerCallback(callback.ID, "زمان تغییر برای این روز به پایان رسیده است")
 			return
 		}
 
-		if err == gorm.ErrRecordNotFound {
-
-			reserve = model.Reserve{
-				Date:      date,
-				UserID:    user.ID,
-				HasLunch:  isLunch || user.AlwaysLunch,
-				HasDinner: isDinner || user.AlwaysDinner,
-			}
-		}
-
-		if selectedOption[len(selectedOption)-5:] == "lunch" {
-
-			reserve.HasLunch = !reserve.HasLunch
-		} else if selectedOption[len(selectedOption)-6:] == "dinner" {
-
-			reserve.HasDinner = !reserve.HasDinner
-		} else {
-
-			log.Println("Invalid option " + selectedOption)
+		if err != nil {
+			log.Println(err)
 			return
 		}
 
-		db.Save(&reserve)
-
 		if user.AlwaysLunch || user.AlwaysDinner {
-			telegramBot.AnswerCallbackQuery(tgbotapi.NewCallback(callback.ID, fmt.Sprintf("حالت اتوماتیک برای %s غیر فعال شد.", utils.GetFaDayName(date.Weekday()))))
+			bot.AnswerCallback(callback.ID, fmt.Sprintf("حالت اتوماتیک برای %s غیر فعال شد.", utils.GetFaDayName(date.Weekday())))
 
 		}
 
 		// Send the updated message to the user
-		telegramBot.AnswerCallbackQuery(tgbotapi.NewCallback(callback.ID, fmt.Sprintf("%s تغییر کرد", utils.GetFaDayName(date.Weekday()))))
+		bot.AnswerCallback(callback.ID, fmt.Sprintf("%s تغییر کرد", utils.GetFaDayName(date.Weekday())))
 
 	}
 
-	var lastMessageID int
-	item, found := memCache.Get(fmt.Sprintf("user_%d_last_message", callback.From.ID))
+	lastMessageID, found := lastMessages.Get(callback.Message.Chat.ID)
 	if !found {
 		lastMessageID = callback.Message.MessageID
-	} else {
-		lastMessageID = item.(int)
 	}
 
 	// remove last meal selection message
-	_, err := telegramBot.DeleteMessage(tgbotapi.DeleteMessageConfig{
-		ChatID:    callback.Message.Chat.ID,
-		MessageID: lastMessageID,
-	})
+	err := bot.DeleteMessage(callback.Message.Chat.ID, lastMessageID)
 
 	if err != nil {
 		log.Println(err)
@@ -786,6 +734,14 @@ func handleButtonPress(user model.User, callback *tgbotapi.CallbackQuery) {
 	showMealSelectionForm(user, callback.Message.Chat.ID)
 }
 
+// handleInvalidCallback answers presses on buttons whose data doesn't decode, like the ones sent before an update.
+func handleInvalidCallback(c *Context) {
+
+	log.Printf("invalid callback data %q from %s", c.Update.CallbackQuery.Data, c.Username())
+
+	bot.AnswerCallback(c.Update.CallbackQuery.ID, "این دکمه قدیمی است، دوباره از منو انتخاب کنید")
+}
+
 // Get the button text depending on whether the meal is selected or not
 func getButtonText(meal string, selected bool) string {
 	if selected {
@@ -796,19 +752,5 @@ func getButtonText(meal string, selected bool) string {
 }
 
 func isAdmin(username string) bool {
-	admins := utils.Getenv("ADMINS", "")
-	var adminList []string
-	err := json.Unmarshal([]byte(admins), &adminList)
-	if err != nil {
-		log.Println(err)
-		return false
-	}
-
-	for _, admin := range adminList {
-		if admin == username {
-			return true
-		}
-	}
-
-	return false
+	return username != "" && slices.Contains(conf.Telegram.Admins, username)
 }
@@ -0,0 +1,60 @@
+package telegramBot
+
+import (
+	"fmt"
+	"log"
+	"luncher/handler/messenger"
+	model "luncher/handler/models"
+	"luncher/handler/utils"
+)
+
+// showCalendarLink sends the personal calendar feed link of the user, rotate replaces the old link.
+func showCalendarLink(user model.User, chatID int64, rotate bool) {
+
+	publicURL := conf.HTTP.PublicURL
+	if publicURL == "" {
+		bot.SendMessage(messenger.NewMessage(chatID, "تقویم فعال نیست."))
+		return
+	}
+
+	if user.CalendarToken == nil || rotate {
+
+		token := utils.GenerateToken(32)
+		user.CalendarToken = &token
+
+		if err := store.SaveUser(&user); err != nil {
+			log.Println("save calendar token error", err)
+			bot.SendMessage(messenger.NewMessage(chatID, "خطا در ارتباط با دیتابیس"))
+			return
+		}
+	}
+
+	messageStr := fmt.Sprintf(
+		"لینک تقویم شما:\n%s/calendar/%s.ics\n\nاین لینک را در تقویم خود اضافه کنید و آن را با کسی به اشتراک نگذارید.",
+		publicURL, *user.CalendarToken,
+	)
+
+	keyboard := keyboard{}
+	keyboard.Row(keyboard.Button("ساخت لینک جدید", NewCallback(ActionRotateCalendar)))
+
+	if err := keyboard.Err(); err != nil {
+		log.Println("show calendar keyboard error", err)
+		return
+	}
+
+	msg := messenger.NewMessage(chatID, messageStr)
+	msg.Keyboard = keyboard.Rows()
+	msg.DisableWebPagePreview = true
+
+	_, err := bot.SendMessage(msg)
+	if err != nil {
+		log.Println("show calendar link error", err)
+	}
+}
+
+func handleCalendarRotate(c *Context) {
+
+	bot.AnswerCallback(c.Update.CallbackQuery.ID, "لینک قبلی غیر فعال شد")
+
+	showCalendarLink(c.User, int64(c.Update.CallbackQuery.From.ID), true)
+}
@@ -0,0 +1,175 @@
+package telegramBot
+
+import (
+	"errors"
+	"fmt"
+	"luncher/handler/messenger"
+	"luncher/service/reservation"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// callbackVersion starts the data of every button, presses on buttons sent by another version are rejected.
+const callbackVersion = "v1"
+
+// callbackDataLimit is the most bytes telegram accepts as the data of a button.
+const callbackDataLimit = 64
+
+const callbackSeparator = ":"
+
+// Action is what a button press does, the arguments it takes follow it in the callback data.
+type Action string
+
+const (
+	ActionNoop           Action = "noop"
+	ActionRotateCalendar Action = "calendar"
+	ActionToggleMeal     Action = "meal"    // date, meal
+	ActionSelectAll      Action = "all"     // meal
+	ActionSetMeal        Action = "setmeal" // day, meal
+	ActionSetting        Action = "setting" // setting name
+	ActionJob            Action = "job"     // run, pause or resume, job name
+)
+
+// callbackArgs is the number of arguments of each action, data with another count doesn't decode.
+var callbackArgs = map[Action]int{
+	ActionNoop:           0,
+	ActionRotateCalendar: 0,
+	ActionToggleMeal:     2,
+	ActionSelectAll:      1,
+	ActionSetMeal:        2,
+	ActionSetting:        1,
+	ActionJob:            2,
+}
+
+var (
+	ErrCallbackTooLong   = errors.New("callback data too long")
+	ErrCallbackVersion   = errors.New("callback data of another version")
+	ErrCallbackMalformed = errors.New("malformed callback data")
+)
+
+// Callback is the decoded data of a button.
+type Callback struct {
+	Action Action
+	Args   []string
+}
+
+func NewCallback(action Action, args ...string) Callback {
+	return Callback{Action: action, Args: args}
+}
+
+// Encode returns the data of a button sending the callback, like "v1:meal:2024-11-05:lunch".
+func (cb Callback) Encode() (string, error) {
+
+	expected, known := callbackArgs[cb.Action]
+	if !known || len(cb.Args) != expected {
+		return "", fmt.Errorf("%w: action %q with %d arguments", ErrCallbackMalformed, cb.Action, len(cb.Args))
+	}
+
+	for _, arg := range cb.Args {
+		if strings.Contains(arg, callbackSeparator) {
+			return "", fmt.Errorf("%w: argument %q of %s contains %q", ErrCallbackMalformed, arg, cb.Action, callbackSeparator)
+		}
+	}
+
+	data := strings.Join(append([]string{callbackVersion, string(cb.Action)}, cb.Args...), callbackSeparator)
+	if len(data) > callbackDataLimit {
+		return "", fmt.Errorf("%w: %q is %d bytes, telegram accepts %d", ErrCallbackTooLong, data, len(data), callbackDataLimit)
+	}
+
+	return data, nil
+}
+
+// DecodeCallback parses the data of a pressed button, the decoded callback has the arguments its action takes.
+func DecodeCallback(data string) (Callback, error) {
+
+	if len(data) > callbackDataLimit {
+		return Callback{}, ErrCallbackTooLong
+	}
+
+	fields := strings.Split(data, callbackSeparator)
+	if fields[0] != callbackVersion {
+		return Callback{}, fmt.Errorf("%w: %q", ErrCallbackVersion, data)
+	}
+
+	if len(fields) < 2 {
+		return Callback{}, fmt.Errorf("%w: %q", ErrCallbackMalformed, data)
+	}
+
+	action := Action(fields[1])
+	expected, known := callbackArgs[action]
+	if !known || len(fields)-2 != expected {
+		return Callback{}, fmt.Errorf("%w: %q", ErrCallbackMalformed, data)
+	}
+
+	return Callback{Action: action, Args: fields[2:]}, nil
+}
+
+// Arg returns the argument at i, empty when there is none.
+func (cb Callback) Arg(i int) string {
+
+	if i < 0 || i >= len(cb.Args) {
+		return ""
+	}
+
+	return cb.Args[i]
+}
+
+func (cb Callback) Int(i int) (int, error) {
+
+	value, err := strconv.Atoi(cb.Arg(i))
+	if err != nil {
+		return 0, fmt.Errorf("%w: argument %d of %s is not a number", ErrCallbackMalformed, i, cb.Action)
+	}
+
+	return value, nil
+}
+
+func (cb Callback) Date(i int) (time.Time, error) {
+
+	date, err := time.Parse("2006-01-02", cb.Arg(i))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: argument %d of %s is not a date", ErrCallbackMalformed, i, cb.Action)
+	}
+
+	return date, nil
+}
+
+func (cb Callback) Meal(i int) (reservation.Meal, error) {
+
+	switch meal := reservation.Meal(cb.Arg(i)); meal {
+	case reservation.Lunch, reservation.Dinner:
+		return meal, nil
+	default:
+		return "", fmt.Errorf("%w: argument %d of %s is not a meal", ErrCallbackMalformed, i, cb.Action)
+	}
+}
+
+// keyboard builds an inline keyboard of callback buttons, keeping the first callback that failed to encode.
+type keyboard struct {
+	rows [][]messenger.Button
+	err  error
+}
+
+// Button returns a button sending cb, check Err before sending the keyboard.
+func (k *keyboard) Button(text string, cb Callback) messenger.Button {
+
+	data, err := cb.Encode()
+	if err != nil && k.err == nil {
+		k.err = err
+	}
+
+	return messenger.NewButton(text, data)
+}
+
+func (k *keyboard) Row(buttons ...messenger.Button) {
+	k.rows = append(k.rows, messenger.NewRow(buttons...))
+}
+
+func (k *keyboard) Rows() [][]messenger.Button {
+	return k.rows
+}
+
+func (k *keyboard) Err() error {
+	return k.err
+}
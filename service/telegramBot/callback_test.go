@@ -0,0 +1,189 @@
+package telegramBot
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCallbackRoundTrip(t *testing.T) {
+
+	tests := []struct {
+		callback Callback
+		data     string
+	}{
+		{NewCallback(ActionNoop), "v1:noop"},
+		{NewCallback(ActionRotateCalendar), "v1:calendar"},
+		{NewCallback(ActionToggleMeal, "2024-11-05", "lunch"), "v1:meal:2024-11-05:lunch"},
+		{NewCallback(ActionSelectAll, "dinner"), "v1:all:dinner"},
+		{NewCallback(ActionSetMeal, "3", "dinner"), "v1:setmeal:3:dinner"},
+		{NewCallback(ActionSetting, settingAlwaysLunch), "v1:setting:always_lunch"},
+		{NewCallback(ActionJob, jobPause, "reminder"), "v1:job:pause:reminder"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.data, func(t *testing.T) {
+
+			data, err := test.callback.Encode()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if data != test.data {
+				t.Fatalf("encoded %q, want %q", data, test.data)
+			}
+
+			decoded, err := DecodeCallback(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// no arguments decode to an empty slice
+			if decoded.Action != test.callback.Action || len(decoded.Args) != len(test.callback.Args) ||
+				(len(decoded.Args) > 0 && !reflect.DeepEqual(decoded.Args, test.callback.Args)) {
+				t.Fatalf("decoded %+v, want %+v", decoded, test.callback)
+			}
+		})
+	}
+}
+
+func TestCallbackEncodeErrors(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		callback Callback
+		err      error
+	}{
+		{"unknown action", NewCallback("order", "lunch"), ErrCallbackMalformed},
+		{"missing argument", NewCallback(ActionToggleMeal, "2024-11-05"), ErrCallbackMalformed},
+		{"extra argument", NewCallback(ActionSelectAll, "lunch", "dinner"), ErrCallbackMalformed},
+		{"argument for noop", NewCallback(ActionNoop, "x"), ErrCallbackMalformed},
+		{"separator in argument", NewCallback(ActionSetting, "always:lunch"), ErrCallbackMalformed},
+		{"over the limit", NewCallback(ActionJob, jobRun, strings.Repeat("j", callbackDataLimit)), ErrCallbackTooLong},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			data, err := test.callback.Encode()
+			if !errors.Is(err, test.err) {
+				t.Fatalf("encoded %q with error %v, want %v", data, err, test.err)
+			}
+		})
+	}
+}
+
+func TestCallbackDataLimit(t *testing.T) {
+
+	// "v1:setting:" and an argument filling the rest of the limit
+	prefix := "v1:setting:"
+	atLimit := NewCallback(ActionSetting, strings.Repeat("s", callbackDataLimit-len(prefix)))
+
+	data, err := atLimit.Encode()
+	if err != nil || len(data) != callbackDataLimit {
+		t.Fatalf("encoded %d bytes with error %v, want %d", len(data), err, callbackDataLimit)
+	}
+
+	if _, err := DecodeCallback(data); err != nil {
+		t.Fatalf("decoding %d bytes: %v", len(data), err)
+	}
+
+	overLimit := NewCallback(ActionSetting, strings.Repeat("s", callbackDataLimit-len(prefix)+1))
+	if _, err := overLimit.Encode(); !errors.Is(err, ErrCallbackTooLong) {
+		t.Fatalf("encoding over the limit: %v", err)
+	}
+
+	if _, err := DecodeCallback(data + "s"); !errors.Is(err, ErrCallbackTooLong) {
+		t.Fatalf("decoding over the limit: %v", err)
+	}
+}
+
+func TestDecodeCallbackErrors(t *testing.T) {
+
+	tests := []struct {
+		name string
+		data string
+		err  error
+	}{
+		{"empty", "", ErrCallbackVersion},
+		{"unversioned meal button", "2024-11-05_lunch", ErrCallbackVersion},
+		{"unversioned setting button", "setting_always_lunch", ErrCallbackVersion},
+		{"unknown version", "v2:meal:2024-11-05:lunch", ErrCallbackVersion},
+		{"version only", "v1", ErrCallbackMalformed},
+		{"unknown action", "v1:order:lunch", ErrCallbackMalformed},
+		{"empty action", "v1::lunch", ErrCallbackMalformed},
+		{"missing argument", "v1:meal:2024-11-05", ErrCallbackMalformed},
+		{"extra argument", "v1:all:lunch:dinner", ErrCallbackMalformed},
+		{"argument for noop", "v1:noop:x", ErrCallbackMalformed},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			callback, err := DecodeCallback(test.data)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("decoded %+v with error %v, want %v", callback, err, test.err)
+			}
+		})
+	}
+}
+
+func TestCallbackArguments(t *testing.T) {
+
+	callback, err := DecodeCallback("v1:meal:2024-11-05:lunch")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if date, err := callback.Date(0); err != nil || date.Format("2006-01-02") != "2024-11-05" {
+		t.Fatalf("date %v, error %v", date, err)
+	}
+
+	if meal, err := callback.Meal(1); err != nil || meal != "lunch" {
+		t.Fatalf("meal %q, error %v", meal, err)
+	}
+
+	if _, err := callback.Int(0); !errors.Is(err, ErrCallbackMalformed) {
+		t.Fatalf("date read as a number: %v", err)
+	}
+
+	if arg := callback.Arg(2); arg != "" {
+		t.Fatalf("argument past the end is %q", arg)
+	}
+
+	bad, err := DecodeCallback("v1:meal:tomorrow:snack")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := bad.Date(0); !errors.Is(err, ErrCallbackMalformed) {
+		t.Fatalf("invalid date: %v", err)
+	}
+
+	if _, err := bad.Meal(1); !errors.Is(err, ErrCallbackMalformed) {
+		t.Fatalf("invalid meal: %v", err)
+	}
+}
+
+func TestOldButtonIsAnsweredOutdated(t *testing.T) {
+
+	recorder, _ := newTestBot(t)
+	user := testUser(1, "ali")
+
+	sendText(user, "/start")
+
+	for _, data := range []string{"2024-11-05_lunch", "select_all_dinner", "v2:meal:2024-11-05:lunch"} {
+
+		answered := len(recorder.Answered)
+		pressButton(user, 1, data)
+
+		if len(recorder.Answered) != answered+1 {
+			t.Fatalf("%q was not answered", data)
+		}
+
+		if text := recorder.Answered[answered].Text; text != "این دکمه قدیمی است، دوباره از منو انتخاب کنید" {
+			t.Fatalf("%q answered %q", data, text)
+		}
+	}
+}
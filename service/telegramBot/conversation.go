@@ -0,0 +1,161 @@
+package telegramBot
+
+import (
+	"context"
+	"errors"
+	"log"
+	"luncher/handler/messenger"
+	model "luncher/handler/models"
+	"luncher/handler/storage"
+	"time"
+)
+
+// expireConversationsInterval is how often timed out conversations are ended with a notice.
+const expireConversationsInterval = 30 * time.Second
+
+const conversationTimeoutNotice = "زمان پاسخ به پایان رسید، لطفا دوباره تلاش کنید."
+
+// Step handles a message of the user in a conversation and returns the next step, or "" when the conversation is done.
+// Returning the same step asks again, like after an invalid answer. Data changes are kept for the next step.
+type Step func(c *Context, conversation *model.Conversation) string
+
+// Wizard is a flow of several messages, its state is kept in the store so it survives restarts.
+// The user can leave it with /cancel, or by not answering in Timeout.
+type Wizard struct {
+	Name    string
+	Timeout time.Duration
+	Steps   map[string]Step
+}
+
+// Start puts the sender of the update at step of the wizard, replacing any conversation they were in.
+func (w *Wizard) Start(c *Context, step string, data map[string]string) error {
+
+	from := c.From()
+	if from == nil {
+		return errors.New("update has no sender")
+	}
+
+	if data == nil {
+		data = map[string]string{}
+	}
+
+	conversation := model.Conversation{
+		TelegramID: int64(from.ID),
+		ChatID:     c.ChatID(),
+		Wizard:     w.Name,
+		Step:       step,
+		Data:       data,
+		ExpiresAt:  time.Now().Add(w.Timeout),
+	}
+
+	return c.Store.SaveConversation(&conversation)
+}
+
+// handle runs the current step with the message and moves the conversation to the next one.
+func (w *Wizard) handle(c *Context) {
+
+	conversation := c.Conversation
+
+	step, found := w.Steps[conversation.Step]
+	if !found {
+		log.Printf("unknown step %q of wizard %s", conversation.Step, w.Name)
+		endConversation(c.Store, conversation.TelegramID)
+		return
+	}
+
+	next := step(c, conversation)
+	if next == "" {
+		endConversation(c.Store, conversation.TelegramID)
+		return
+	}
+
+	conversation.Step = next
+	conversation.ExpiresAt = time.Now().Add(w.Timeout)
+
+	if err := c.Store.SaveConversation(conversation); err != nil {
+		log.Println("save conversation error", err)
+	}
+}
+
+// loadConversation sets the conversation the sender is in, a timed out one is ended with a notice.
+func loadConversation(next HandlerFunc) HandlerFunc {
+	return func(c *Context) {
+
+		if from := c.From(); from != nil {
+
+			conversation, err := c.Store.FindConversation(int64(from.ID))
+
+			switch {
+			case err == nil && conversation.ExpiresAt.After(time.Now()):
+				c.Conversation = &conversation
+			case err == nil:
+				expireConversation(c.Store, conversation)
+			case !errors.Is(err, storage.ErrNotFound):
+				log.Println("find conversation error", err)
+			}
+		}
+
+		next(c)
+	}
+}
+
+func cancelConversation(c *Context) {
+
+	deleted, err := c.Store.DeleteConversation(int64(c.From().ID))
+	if err != nil {
+		log.Println("delete conversation error", err)
+		return
+	}
+
+	if !deleted {
+		bot.SendMessage(messenger.NewMessage(c.ChatID(), "عملیاتی برای لغو وجود ندارد."))
+		return
+	}
+
+	bot.SendMessage(messenger.NewMessage(c.ChatID(), "لغو شد."))
+}
+
+func endConversation(store storage.Store, telegramID int64) {
+	if _, err := store.DeleteConversation(telegramID); err != nil {
+		log.Println("delete conversation error", err)
+	}
+}
+
+// expireConversation ends a timed out conversation, the notice is sent once even if it's expired elsewhere meanwhile.
+func expireConversation(store storage.Store, conversation model.Conversation) {
+
+	deleted, err := store.DeleteConversation(conversation.TelegramID)
+	if err != nil {
+		log.Println("delete conversation error", err)
+		return
+	}
+
+	if deleted {
+		bot.SendMessage(messenger.NewMessage(conversation.ChatID, conversationTimeoutNotice))
+	}
+}
+
+// expireConversations ends the timed out conversations with a notice, until ctx is done.
+func expireConversations(ctx context.Context) {
+
+	ticker := time.NewTicker(expireConversationsInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		conversations, err := store.ExpireConversations(time.Now())
+		if err != nil {
+			log.Println("expire conversations error", err)
+			continue
+		}
+
+		for _, conversation := range conversations {
+			bot.SendMessage(messenger.NewMessage(conversation.ChatID, conversationTimeoutNotice))
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package telegramBot
+
+import (
+	"context"
+	"luncher/handler/config"
+	"luncher/handler/storage"
+	"luncher/handler/telegramtest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// waitTimeout is how long a test waits for the bot to call the fake API.
+const waitTimeout = 5 * time.Second
+
+// startTestBot runs the bot in polling mode against a fake bot API, until the test ends.
+func startTestBot(t *testing.T) *telegramtest.Server {
+	t.Helper()
+
+	server := telegramtest.NewServer()
+	t.Cleanup(server.Close)
+
+	testConf := config.Default()
+	testConf.Telegram.Token = server.Token
+	testConf.Telegram.APIURL = server.URL
+	if err := testConf.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	LoadBot(testConf, storage.NewMemory())
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	gin.SetMode(gin.TestMode)
+	StartBotServer(ctx, gin.New())
+
+	t.Cleanup(func() {
+		cancel()
+
+		shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), waitTimeout)
+		defer cancelShutdown()
+
+		if err := Shutdown(shutdownCtx); err != nil {
+			t.Error("bot shutdown error", err)
+		}
+	})
+
+	return server
+}
+
+// waitSent waits for the count-th sent message and returns it.
+func waitSent(t *testing.T, server *telegramtest.Server, count int) telegramtest.SentMessage {
+	t.Helper()
+
+	server.WaitFor("sendMessage", count, waitTimeout)
+
+	sent := server.SentMessages()
+	if len(sent) < count {
+		t.Fatalf("bot sent %d messages, want %d", len(sent), count)
+	}
+
+	return sent[count-1]
+}
+
+// waitAnswer waits for the count-th callback answer and returns its text.
+func waitAnswer(t *testing.T, server *telegramtest.Server, count int) string {
+	t.Helper()
+
+	server.WaitFor("answerCallbackQuery", count, waitTimeout)
+
+	answers := server.CallbackAnswers()
+	if len(answers) < count {
+		t.Fatalf("bot answered %d button presses, want %d", len(answers), count)
+	}
+
+	return answers[count-1]
+}
+
+func TestSelectThenToggle(t *testing.T) {
+
+	server := startTestBot(t)
+	user := telegramtest.NewUser(1, "ali")
+
+	server.SendText(user, "/select")
+	form := waitSent(t, server, 1)
+
+	// the last day is always before its edit time
+	lastDay := form.Keyboard[len(form.Keyboard)-1]
+	if strings.HasPrefix(lastDay[1].Text, "✅") {
+		t.Fatalf("lunch button is %q before selecting it", lastDay[1].Text)
+	}
+
+	server.PressButton(user, 1, lastDay[1].CallbackData)
+
+	if answer := waitAnswer(t, server, 1); !strings.HasSuffix(answer, "تغییر کرد") {
+		t.Fatalf("answered %q", answer)
+	}
+
+	replaced := waitSent(t, server, 2)
+	if text := replaced.Keyboard[len(replaced.Keyboard)-1][1].Text; !strings.HasPrefix(text, "✅") {
+		t.Fatalf("lunch button is %q after selecting it", text)
+	}
+
+	server.WaitFor("deleteMessage", 1, waitTimeout)
+	if deleted := server.DeletedMessages(); len(deleted) != 1 {
+		t.Fatalf("deleted %v, want the previous form", deleted)
+	}
+}
+
+func TestToggleAfterCutoff(t *testing.T) {
+
+	server := startTestBot(t)
+	user := telegramtest.NewUser(1, "ali")
+
+	server.SendText(user, "/select")
+	form := waitSent(t, server, 1)
+
+	// the edit time of today passed yesterday
+	today := form.Keyboard[1]
+	server.PressButton(user, 1, today[1].CallbackData)
+
+	if answer := waitAnswer(t, server, 1); answer != "زمان تغییر برای این روز به پایان رسیده است" {
+		t.Fatalf("answered %q", answer)
+	}
+
+	if sent := server.SentMessages(); len(sent) != 1 {
+		t.Fatalf("bot sent %d messages after a rejected press, want only the form", len(sent))
+	}
+}
+
+func TestOutdatedButton(t *testing.T) {
+
+	server := startTestBot(t)
+	user := telegramtest.NewUser(1, "ali")
+
+	server.SendText(user, "/start")
+	waitSent(t, server, 1)
+
+	// a button of the meal form sent before the callback data had a version
+	server.PressButton(user, 1, "2024-11-05_lunch")
+
+	if answer := waitAnswer(t, server, 1); !strings.HasPrefix(answer, "این دکمه قدیمی است") {
+		t.Fatalf("answered %q", answer)
+	}
+}
@@ -0,0 +1,227 @@
+package telegramBot
+
+import (
+	"luncher/handler/config"
+	"luncher/handler/messenger"
+	"luncher/handler/storage"
+	"luncher/handler/utils"
+	"luncher/service/reservation"
+	"strings"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+const testAdmin = "admin"
+
+// newTestBot sets up the handlers with a memory store and a recorder instead of telegram.
+func newTestBot(t *testing.T) (*messenger.Recorder, storage.Store) {
+	t.Helper()
+
+	testConf := config.Default()
+	testConf.Telegram.Token = "test"
+	testConf.Telegram.Admins = []string{testAdmin}
+	if err := testConf.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	conf = testConf
+	store = storage.NewMemory()
+	lastMessages = utils.NewCache[int64, int](utils.CacheOptions{MaxSize: 100, TTL: time.Minute})
+	router = newRouter()
+
+	recorder := messenger.NewRecorder()
+	SetMessenger(recorder)
+
+	return recorder, store
+}
+
+func testUser(id int, username string) *tgbotapi.User {
+	return &tgbotapi.User{ID: id, UserName: username, FirstName: username}
+}
+
+func sendText(from *tgbotapi.User, text string) {
+
+	chat := &tgbotapi.Chat{ID: int64(from.ID), UserName: from.UserName, FirstName: from.FirstName}
+
+	router.Handle(&Context{Store: store, Update: tgbotapi.Update{
+		Message: &tgbotapi.Message{From: from, Chat: chat, Text: text},
+	}})
+}
+
+func pressButton(from *tgbotapi.User, messageID int, data string) {
+
+	chat := &tgbotapi.Chat{ID: int64(from.ID)}
+
+	router.Handle(&Context{Store: store, Update: tgbotapi.Update{
+		CallbackQuery: &tgbotapi.CallbackQuery{
+			ID:      "callback",
+			From:    from,
+			Data:    data,
+			Message: &tgbotapi.Message{MessageID: messageID, Chat: chat},
+		},
+	}})
+}
+
+func lastSent(t *testing.T, recorder *messenger.Recorder) messenger.SentMessage {
+	t.Helper()
+
+	message, ok := recorder.LastSent()
+	if !ok {
+		t.Fatal("no message sent")
+	}
+
+	return message
+}
+
+func TestSelectSendsMealForm(t *testing.T) {
+
+	recorder, _ := newTestBot(t)
+	user := testUser(1, "ali")
+
+	sendText(user, "/select")
+
+	form := lastSent(t, recorder)
+	if form.ChatID != 1 {
+		t.Fatalf("form sent to %d, want 1", form.ChatID)
+	}
+
+	// the select all row, then one row per day
+	if len(form.Keyboard) != 1+conf.Reserve.PlanningDays {
+		t.Fatalf("form has %d rows, want %d", len(form.Keyboard), 1+conf.Reserve.PlanningDays)
+	}
+
+	today := reservation.NewPolicy(conf).Today().Format("2006-01-02")
+	if data := form.Keyboard[1][1].Data; data != "v1:meal:"+today+":lunch" {
+		t.Fatalf("lunch button of today sends %q", data)
+	}
+}
+
+func TestToggleMealReplacesForm(t *testing.T) {
+
+	recorder, store := newTestBot(t)
+	user := testUser(1, "ali")
+
+	sendText(user, "/select")
+	form := lastSent(t, recorder)
+
+	// the last day is always before its edit time
+	lastDay := form.Keyboard[len(form.Keyboard)-1]
+	pressButton(user, form.ID, lastDay[1].Data)
+
+	if len(recorder.Answered) != 1 || !strings.HasSuffix(recorder.Answered[0].Text, "تغییر کرد") {
+		t.Fatalf("answered %+v", recorder.Answered)
+	}
+
+	if len(recorder.Deleted) != 1 || recorder.Deleted[0].MessageID != form.ID {
+		t.Fatalf("deleted %+v, want the form %d", recorder.Deleted, form.ID)
+	}
+
+	replaced := lastSent(t, recorder)
+	if replaced.ID == form.ID {
+		t.Fatal("form was not sent again")
+	}
+
+	if text := replaced.Keyboard[len(replaced.Keyboard)-1][1].Text; !strings.HasPrefix(text, "✅") {
+		t.Fatalf("lunch button is %q after selecting it", text)
+	}
+
+	saved, err := store.FindUser(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	callback, err := DecodeCallback(lastDay[1].Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	date, _ := callback.Date(0)
+	reserve, err := store.FindReserve(saved.ID, date)
+	if err != nil || !reserve.HasLunch {
+		t.Fatalf("reserve %+v, error %v, want lunch", reserve, err)
+	}
+}
+
+func TestSettingPressTogglesAlwaysLunch(t *testing.T) {
+
+	recorder, store := newTestBot(t)
+	user := testUser(1, "ali")
+
+	sendText(user, "/setting")
+	form := lastSent(t, recorder)
+
+	pressButton(user, form.ID, form.Keyboard[0][1].Data)
+
+	saved, err := store.FindUser(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !saved.AlwaysLunch {
+		t.Fatal("always lunch was not set")
+	}
+
+	if len(recorder.Deleted) != 1 || recorder.Deleted[0].MessageID != form.ID {
+		t.Fatalf("deleted %+v, want the setting form %d", recorder.Deleted, form.ID)
+	}
+
+	if text := lastSent(t, recorder).Keyboard[0][1].Text; !strings.HasPrefix(text, "✅") {
+		t.Fatalf("always lunch button is %q after setting it", text)
+	}
+}
+
+func TestHelpShowsConfiguredCutoff(t *testing.T) {
+
+	recorder, _ := newTestBot(t)
+	conf.Reserve.Cutoff = config.ClockTime(16 * time.Hour)
+
+	sendText(testUser(1, "ali"), "/help")
+
+	if text := lastSent(t, recorder).Text; !strings.Contains(text, "تا ساعت 16:00 روز قبل") {
+		t.Fatalf("help is %q", text)
+	}
+}
+
+func TestAdminCommandRejectsUsers(t *testing.T) {
+
+	recorder, _ := newTestBot(t)
+
+	sendText(testUser(1, "ali"), "/setList")
+
+	if text := lastSent(t, recorder).Text; text != "شما دسترسی ندارید." {
+		t.Fatalf("sent %q to a user", text)
+	}
+}
+
+func TestSetMealWizard(t *testing.T) {
+
+	recorder, store := newTestBot(t)
+	admin := testUser(2, testAdmin)
+
+	sendText(admin, "/setList")
+	list := lastSent(t, recorder)
+
+	// the dinner button of the third day
+	pressButton(admin, list.ID, list.Keyboard[2][0].Data)
+
+	if text := lastSent(t, recorder).Text; !strings.HasPrefix(text, "Enter dinner for day 3") {
+		t.Fatalf("asked %q", text)
+	}
+
+	sendText(admin, "Kabab")
+
+	meal, err := store.FindMeal(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if meal.Dinner == nil || *meal.Dinner != "Kabab" {
+		t.Fatalf("dinner of day 3 is %v", meal.Dinner)
+	}
+
+	if _, err := store.FindConversation(2); err == nil {
+		t.Fatal("conversation was not ended")
+	}
+}
@@ -0,0 +1,135 @@
+package telegramBot
+
+import (
+	"fmt"
+	"log"
+	"luncher/handler/messenger"
+	"luncher/handler/scheduler"
+	"strings"
+	"time"
+)
+
+// the operations of the /jobs buttons
+const (
+	jobRun    = "run"
+	jobPause  = "pause"
+	jobResume = "resume"
+)
+
+// jobs are the scheduled jobs listed by /jobs, set with SetScheduler
+var jobs *scheduler.Scheduler
+
+// SetScheduler sets the scheduler whose jobs admins can list, run and pause.
+func SetScheduler(s *scheduler.Scheduler) {
+	jobs = s
+}
+
+func showJobs(chatID int64) {
+
+	if jobs == nil {
+		bot.SendMessage(messenger.NewMessage(chatID, "زمان‌بندی فعال نیست."))
+		return
+	}
+
+	statuses, err := jobs.Status()
+	if err != nil {
+		log.Println("job status error", err)
+		bot.SendMessage(messenger.NewMessage(chatID, "خطا در ارتباط با دیتابیس"))
+		return
+	}
+
+	var text strings.Builder
+	keyboard := keyboard{}
+
+	for _, status := range statuses {
+
+		state := "فعال"
+		pauseButton := keyboard.Button("⏸ "+status.Name, NewCallback(ActionJob, jobPause, status.Name))
+		if status.Paused {
+			state = "متوقف"
+			pauseButton = keyboard.Button("⏯ "+status.Name, NewCallback(ActionJob, jobResume, status.Name))
+		}
+
+		text.WriteString(fmt.Sprintf("%s (%s)\n%s\n", status.Name, state, status.Schedule))
+		text.WriteString(fmt.Sprintf("اجرای بعدی: %s\n", formatJobTime(status.NextRunAt)))
+
+		for _, run := range status.Runs {
+
+			result := "✅"
+			if run.FinishedAt == nil {
+				result = "⏳"
+			} else if run.Error != "" {
+				result = "❌ " + run.Error
+			}
+
+			text.WriteString(fmt.Sprintf("%s %s %s\n", formatJobTime(run.StartedAt), run.Trigger, result))
+		}
+
+		text.WriteString("\n")
+
+		keyboard.Row(
+			pauseButton,
+			keyboard.Button("▶️ "+status.Name, NewCallback(ActionJob, jobRun, status.Name)),
+		)
+	}
+
+	if err := keyboard.Err(); err != nil {
+		log.Println("show jobs keyboard error", err)
+		return
+	}
+
+	msg := messenger.NewMessage(chatID, text.String())
+	msg.Keyboard = keyboard.Rows()
+	msg.DisableNotification = true
+	bot.SendMessage(msg)
+}
+
+// handleJobPress runs, pauses or resumes a job, from the buttons of /jobs.
+func handleJobPress(c *Context) {
+
+	callback := c.Update.CallbackQuery
+
+	action, name := c.Callback.Arg(0), c.Callback.Arg(1)
+
+	var err error
+	var answer string
+
+	switch {
+	case jobs == nil:
+		err = scheduler.ErrUnknownJob
+	case action == jobRun:
+		err = jobs.Trigger(name)
+		answer = fmt.Sprintf("%s اجرا شد", name)
+	case action == jobPause:
+		err = jobs.SetPaused(name, true)
+		answer = fmt.Sprintf("%s متوقف شد", name)
+	case action == jobResume:
+		err = jobs.SetPaused(name, false)
+		answer = fmt.Sprintf("%s فعال شد", name)
+	default:
+		err = scheduler.ErrUnknownJob
+	}
+
+	if err != nil {
+		log.Printf("job %s %s error %v", action, name, err)
+		bot.AnswerCallback(callback.ID, "خطا")
+		return
+	}
+
+	bot.AnswerCallback(callback.ID, answer)
+
+	if err := bot.DeleteMessage(callback.Message.Chat.ID, callback.Message.MessageID); err != nil {
+		log.Println(err)
+	}
+
+	showJobs(callback.Message.Chat.ID)
+}
+
+func formatJobTime(t time.Time) string {
+
+	if t.IsZero() {
+		return "-"
+	}
+
+	return t.In(conf.Location()).Format("2006-01-02 15:04")
+}
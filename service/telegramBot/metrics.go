@@ -0,0 +1,39 @@
+package telegramBot
+
+import (
+	"luncher/handler/metrics"
+	"time"
+)
+
+// observeUpdate measures updates by their route, messages without a command are counted as text.
+func observeUpdate(next HandlerFunc) HandlerFunc {
+	return func(c *Context) {
+
+		start := time.Now()
+
+		next(c)
+
+		duration := time.Since(start).Seconds()
+
+		route := c.Route
+		if route == "" {
+			route = "unknown"
+		}
+
+		if c.Update.Message != nil {
+
+			if c.Route == "" && commandName(c.Update.Message.Text) == "" {
+				route = "text"
+			}
+
+			metrics.Commands.WithLabelValues(route).Inc()
+			metrics.CommandDuration.WithLabelValues(route).Observe(duration)
+		}
+
+		if c.Update.CallbackQuery != nil {
+
+			metrics.Callbacks.WithLabelValues(route).Inc()
+			metrics.CallbackDuration.WithLabelValues(route).Observe(duration)
+		}
+	}
+}
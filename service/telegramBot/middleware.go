@@ -0,0 +1,104 @@
+package telegramBot
+
+import (
+	"log"
+	"luncher/handler/messenger"
+	model "luncher/handler/models"
+	"runtime/debug"
+	"time"
+)
+
+// recoverPanic keeps a panicking handler from stopping the update loop.
+func recoverPanic(next HandlerFunc) HandlerFunc {
+	return func(c *Context) {
+
+		defer func() {
+			if err := recover(); err != nil {
+				log.Printf("panic handling update %d: %v\n%s", c.Update.UpdateID, err, debug.Stack())
+			}
+		}()
+
+		next(c)
+	}
+}
+
+func logUpdate(next HandlerFunc) HandlerFunc {
+	return func(c *Context) {
+
+		start := time.Now()
+
+		next(c)
+
+		log.Printf("update %d from %s, route %q, took %s", c.Update.UpdateID, c.Username(), c.Route, time.Since(start))
+	}
+}
+
+// loadUser sets the user of the update, users sending a message are created on their first one.
+func loadUser(next HandlerFunc) HandlerFunc {
+	return func(c *Context) {
+
+		from := c.From()
+		if from == nil {
+			return
+		}
+
+		telegramID := int64(from.ID)
+		if c.Update.Message != nil {
+			telegramID = c.Update.Message.Chat.ID
+		}
+
+		user := findUser(c.Store, telegramID)
+
+		if user.ID == 0 {
+
+			if c.Update.Message == nil {
+				bot.SendMessage(messenger.NewMessage(c.ChatID(), "خطا در ارتباط با دیتابیس"))
+				return
+			}
+
+			user = createUser(c)
+		}
+
+		// a user writing to the bot has unblocked it
+		if user.UnreachableAt != nil {
+			user.UnreachableAt = nil
+			if err := c.Store.SaveUser(&user); err != nil {
+				log.Println("save reachable user error", err)
+			}
+		}
+
+		c.User = user
+
+		next(c)
+	}
+}
+
+// adminOnly rejects users not listed in ADMINS.
+func adminOnly(next HandlerFunc) HandlerFunc {
+	return func(c *Context) {
+
+		if !isAdmin(c.Username()) {
+
+			bot.SendMessage(messenger.NewMessage(c.ChatID(), "شما دسترسی ندارید."))
+
+			log.Printf("Unauthorized access - username: %s", c.Username())
+			return
+		}
+
+		next(c)
+	}
+}
+
+func createUser(c *Context) model.User {
+	user := model.User{
+		TelegramID: c.Update.Message.Chat.ID,
+		Username:   c.Update.Message.Chat.UserName,
+		Name:       c.Update.Message.Chat.FirstName,
+	}
+
+	if err := c.Store.SaveUser(&user); err != nil {
+		log.Println("create user error", err)
+	}
+
+	return user
+}
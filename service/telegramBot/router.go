@@ -0,0 +1,179 @@
+package telegramBot
+
+import (
+	model "luncher/handler/models"
+	"luncher/handler/storage"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// Context is the state of one update passed through middlewares and handlers.
+type Context struct {
+	Update tgbotapi.Update
+	Store  storage.Store
+
+	// User is set by the loadUser middleware.
+	User model.User
+
+	// Conversation is set by the loadConversation middleware, nil when the user isn't in one.
+	Conversation *model.Conversation
+
+	// Callback is the decoded data of a button press, set by the router.
+	Callback Callback
+
+	// Route is the matched command or callback action, empty when nothing matched.
+	Route string
+}
+
+type HandlerFunc func(c *Context)
+
+type Middleware func(next HandlerFunc) HandlerFunc
+
+// Router dispatches messages by command and button presses by callback action.
+type Router struct {
+	middlewares     []Middleware
+	commands        map[string]HandlerFunc
+	callbacks       map[Action]HandlerFunc
+	invalidCallback HandlerFunc
+	wizards         map[string]*Wizard
+}
+
+func NewRouter() *Router {
+	return &Router{
+		commands:  map[string]HandlerFunc{},
+		callbacks: map[Action]HandlerFunc{},
+		wizards:   map[string]*Wizard{},
+	}
+}
+
+// Use adds middlewares running around every update, in the given order.
+func (r *Router) Use(middlewares ...Middleware) {
+	r.middlewares = append(r.middlewares, middlewares...)
+}
+
+// Command registers the handler of a command like "/select".
+func (r *Router) Command(command string, handler HandlerFunc, middlewares ...Middleware) {
+	r.commands[command] = chain(handler, middlewares...)
+}
+
+// Callback registers the handler of button presses of an action.
+func (r *Router) Callback(action Action, handler HandlerFunc, middlewares ...Middleware) {
+	r.callbacks[action] = chain(handler, middlewares...)
+}
+
+// InvalidCallback registers the handler of button presses whose data doesn't decode or has no handler.
+func (r *Router) InvalidCallback(handler HandlerFunc, middlewares ...Middleware) {
+	r.invalidCallback = chain(handler, middlewares...)
+}
+
+// Wizard registers a wizard, messages other than commands of users in its conversations go to its steps.
+func (r *Router) Wizard(wizard *Wizard) {
+	r.wizards[wizard.Name] = wizard
+}
+
+// Handle runs the update through the middlewares and its handler.
+func (r *Router) Handle(c *Context) {
+	chain(r.dispatch, r.middlewares...)(c)
+}
+
+func (r *Router) dispatch(c *Context) {
+
+	if c.Update.Message != nil {
+
+		command := commandName(c.Update.Message.Text)
+		if handler, found := r.commands[command]; found {
+			c.Route = command
+			handler(c)
+			return
+		}
+
+		if command == "" && c.Conversation != nil {
+			if wizard, found := r.wizards[c.Conversation.Wizard]; found {
+				c.Route = wizard.Name + "." + c.Conversation.Step
+				wizard.handle(c)
+			}
+		}
+		return
+	}
+
+	if c.Update.CallbackQuery != nil {
+
+		callback, err := DecodeCallback(c.Update.CallbackQuery.Data)
+		if err == nil {
+			if handler, found := r.callbacks[callback.Action]; found {
+				c.Callback = callback
+				c.Route = string(callback.Action)
+				handler(c)
+				return
+			}
+		}
+
+		if r.invalidCallback != nil {
+			c.Route = "invalid"
+			r.invalidCallback(c)
+		}
+	}
+}
+
+// commandName returns the command of a message text, without arguments and bot username.
+func commandName(text string) string {
+
+	fields := strings.Fields(text)
+	if len(fields) == 0 || !strings.HasPrefix(fields[0], "/") {
+		return ""
+	}
+
+	command, _, _ := strings.Cut(fields[0], "@")
+
+	return command
+}
+
+// chain wraps the handler with middlewares, the first one runs first.
+func chain(handler HandlerFunc, middlewares ...Middleware) HandlerFunc {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
+
+// ChatID returns the chat the update came from.
+func (c *Context) ChatID() int64 {
+
+	if c.Update.Message != nil {
+		return c.Update.Message.Chat.ID
+	}
+
+	if c.Update.CallbackQuery != nil {
+		if c.Update.CallbackQuery.Message != nil {
+			return c.Update.CallbackQuery.Message.Chat.ID
+		}
+		return int64(c.Update.CallbackQuery.From.ID)
+	}
+
+	return 0
+}
+
+// From returns the telegram user who sent the update.
+func (c *Context) From() *tgbotapi.User {
+
+	if c.Update.Message != nil {
+		return c.Update.Message.From
+	}
+
+	if c.Update.CallbackQuery != nil {
+		return c.Update.CallbackQuery.From
+	}
+
+	return nil
+}
+
+// Username returns the telegram username of the sender, empty when unknown.
+func (c *Context) Username() string {
+
+	if from := c.From(); from != nil {
+		return from.UserName
+	}
+
+	return ""
+}
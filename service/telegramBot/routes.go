@@ -0,0 +1,34 @@
+package telegramBot
+
+// newRouter registers all commands and buttons of the bot.
+func newRouter() *Router {
+
+	router := NewRouter()
+	router.Use(recoverPanic, observeUpdate, logUpdate, loadUser, loadConversation)
+
+	router.Command("/start", showHelp)
+	router.Command("/help", showHelp)
+	router.Command("/select", func(c *Context) { showMealSelectionForm(c.User, c.ChatID()) })
+	router.Command("/setting", func(c *Context) { showSettingForm(c.User, c.ChatID()) })
+	router.Command("/app", func(c *Context) { showWebAppButton(c.ChatID()) })
+	router.Command("/calendar", func(c *Context) { showCalendarLink(c.User, c.ChatID(), false) })
+	router.Command("/cancel", cancelConversation)
+
+	router.Command("/setList", func(c *Context) { showMealSetFrom(c.ChatID()) }, adminOnly)
+	router.Command("/getCounts", showCounts, adminOnly)
+	router.Command("/getReserves", showReservesDetails, adminOnly)
+	router.Command("/jobs", func(c *Context) { showJobs(c.ChatID()) }, adminOnly)
+
+	router.Wizard(setMealWizard)
+
+	router.Callback(ActionNoop, func(c *Context) {})
+	router.Callback(ActionToggleMeal, handleButtonPress)
+	router.Callback(ActionSelectAll, handleButtonPress)
+	router.Callback(ActionSetMeal, handleSetMealList, adminOnly)
+	router.Callback(ActionJob, handleJobPress, adminOnly)
+	router.Callback(ActionSetting, handleSettingPress)
+	router.Callback(ActionRotateCalendar, handleCalendarRotate)
+	router.InvalidCallback(handleInvalidCallback)
+
+	return router
+}
@@ -0,0 +1,45 @@
+package telegramBot
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Status reports the state of the bot loops for health checks.
+type Status struct {
+	Mode          string    `json:"mode"`
+	StartedAt     time.Time `json:"started_at"`
+	LastUpdatesAt time.Time `json:"last_updates_at"`
+	CacheSize     int       `json:"cache_size"`
+}
+
+var (
+	botMode       atomic.Value
+	startedAt     atomic.Int64
+	lastUpdatesAt atomic.Int64
+)
+
+func GetStatus() Status {
+
+	status := Status{
+		StartedAt:     unixTime(startedAt.Load()),
+		LastUpdatesAt: unixTime(lastUpdatesAt.Load()),
+	}
+
+	if mode, ok := botMode.Load().(string); ok {
+		status.Mode = mode
+	}
+
+	if lastMessages != nil {
+		status.CacheSize = lastMessages.Len()
+	}
+
+	return status
+}
+
+func unixTime(nano int64) time.Time {
+	if nano == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nano)
+}
@@ -0,0 +1,60 @@
+package telegramBot
+
+import (
+	"crypto/subtle"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// secretTokenHeader is sent by telegram on every webhook request, see setWebhook secret_token.
+const secretTokenHeader = "X-Telegram-Bot-Api-Secret-Token"
+
+// startWebhook registers the webhook route on gin and tells telegram where to send updates.
+func startWebhook(app *gin.Engine) {
+
+	webhookURL := conf.Telegram.WebhookURL
+	webhookPath := conf.Telegram.WebhookPath
+	secret := conf.Telegram.WebhookSecret
+
+	app.POST(webhookPath, webhookHandler(secret))
+
+	_, err := telegramBot.MakeRequest("setWebhook", url.Values{
+		"url":             {webhookURL},
+		"secret_token":    {secret},
+		"allowed_updates": {`["message","callback_query"]`},
+	})
+	if err != nil {
+		log.Panic("set webhook error ", err)
+	}
+
+	log.Printf("Webhook set, listening on %s", webhookPath)
+}
+
+func webhookHandler(secret string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		token := c.GetHeader(secretTokenHeader)
+		if subtle.ConstantTimeCompare([]byte(token), []byte(secret)) != 1 {
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+
+		var update tgbotapi.Update
+		if err := c.ShouldBindJSON(&update); err != nil {
+			log.Println("invalid webhook update", err)
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+
+		lastUpdatesAt.Store(time.Now().UnixNano())
+
+		handleUpdate(update)
+
+		c.Status(http.StatusOK)
+	}
+}
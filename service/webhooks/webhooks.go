@@ -0,0 +1,232 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"luncher/handler/config"
+	"luncher/handler/events"
+	model "luncher/handler/models"
+	"luncher/handler/storage"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	maxAttempts    = 6
+	baseBackoff    = 5 * time.Second
+	requestTimeout = 10 * time.Second
+
+	// pollInterval is how often due deliveries are read when nothing was recorded on this instance
+	pollInterval = 5 * time.Second
+
+	batchSize = 100
+)
+
+var client = &http.Client{Timeout: requestTimeout}
+
+// Webhooks records the deliveries of published events on every instance, Run sends them on the leader.
+type Webhooks struct {
+	store    storage.WebhookDeliveries
+	webhooks []config.Webhook
+
+	// wake is signaled when deliveries are recorded, so the sender doesn't wait for the next poll
+	wake chan struct{}
+}
+
+func New(store storage.WebhookDeliveries, webhooks []config.Webhook) *Webhooks {
+	return &Webhooks{
+		store:    store,
+		webhooks: webhooks,
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+// Record keeps a delivery of every published event for each webhook subscribed to it, until ctx is done.
+// It runs on every instance, events are only published on the instance they happened on.
+// It listens instead of subscribing, so no event is missed when publishing is faster than the database.
+func (w *Webhooks) Record(ctx context.Context) {
+
+	if len(w.webhooks) == 0 {
+		return
+	}
+
+	unlisten := events.Listen(w.record)
+	defer unlisten()
+
+	<-ctx.Done()
+}
+
+func (w *Webhooks) record(event events.Event) {
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		log.Println("webhook payload error", err)
+		return
+	}
+
+	deliveries := []model.WebhookDelivery{}
+	for _, webhook := range w.webhooks {
+
+		if len(webhook.Events) > 0 && !slices.Contains(webhook.Events, event.Type) {
+			continue
+		}
+
+		deliveries = append(deliveries, model.WebhookDelivery{
+			URL:           webhook.URL,
+			Event:         event.Type,
+			Payload:       string(payload),
+			Status:        model.WebhookPending,
+			NextAttemptAt: time.Now(),
+		})
+	}
+
+	if len(deliveries) == 0 {
+		return
+	}
+
+	if err := w.store.CreateWebhookDeliveries(deliveries); err != nil {
+		log.Println("create webhook delivery error", err)
+		return
+	}
+
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run sends the due deliveries until ctx is done, it must run on the leader only so each one is sent once.
+// Deliveries still pending then are sent by the next leader.
+func (w *Webhooks) Run(ctx context.Context) {
+
+	if len(w.webhooks) == 0 {
+		return
+	}
+
+	for {
+		w.deliverDue(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-w.wake:
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// deliverDue makes one attempt of each due delivery in a batch, all at once.
+func (w *Webhooks) deliverDue(ctx context.Context) {
+
+	deliveries, err := w.store.DueWebhookDeliveries(time.Now(), batchSize)
+	if err != nil {
+		log.Println("load due webhook deliveries error", err)
+		return
+	}
+
+	var wg sync.WaitGroup
+	for i := range deliveries {
+
+		delivery := &deliveries[i]
+
+		index := slices.IndexFunc(w.webhooks, func(webhook config.Webhook) bool {
+			return webhook.URL == delivery.URL
+		})
+
+		if index == -1 {
+			delivery.Status = model.WebhookFailed
+			delivery.LastError = "webhook is not configured anymore"
+			w.save(delivery)
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.deliver(ctx, w.webhooks[index], delivery)
+		}()
+	}
+
+	wg.Wait()
+}
+
+// deliver makes one attempt, a failed one is retried later, waiting longer after each failure.
+func (w *Webhooks) deliver(ctx context.Context, webhook config.Webhook, delivery *model.WebhookDelivery) {
+
+	statusCode, err := send(ctx, webhook, *delivery)
+
+	// interrupted by the shutdown or a leader change, the next leader attempts it again
+	if ctx.Err() != nil {
+		return
+	}
+
+	delivery.Attempts++
+	delivery.LastStatusCode = statusCode
+	delivery.LastError = ""
+
+	if err == nil {
+
+		now := time.Now()
+		delivery.Status = model.WebhookDelivered
+		delivery.DeliveredAt = &now
+	} else {
+
+		delivery.LastError = err.Error()
+
+		if delivery.Attempts >= maxAttempts {
+			delivery.Status = model.WebhookFailed
+			log.Printf("webhook delivery %d to %s failed: %s", delivery.ID, delivery.URL, err)
+		} else {
+			delivery.NextAttemptAt = time.Now().Add(baseBackoff << (delivery.Attempts - 1))
+		}
+	}
+
+	w.save(delivery)
+}
+
+func (w *Webhooks) save(delivery *model.WebhookDelivery) {
+	if err := w.store.SaveWebhookDelivery(delivery); err != nil {
+		log.Println("save webhook delivery error", err)
+	}
+}
+
+// send posts the payload, signed as hex HMAC-SHA256 of "<timestamp>.<payload>" with the webhook secret.
+func send(ctx context.Context, webhook config.Webhook, delivery model.WebhookDelivery) (int, error) {
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	signature := hmac.New(sha256.New, []byte(webhook.Secret))
+	signature.Write([]byte(timestamp + "." + delivery.Payload))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewBufferString(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Luncher-Event", delivery.Event)
+	req.Header.Set("X-Luncher-Delivery", strconv.FormatUint(uint64(delivery.ID), 10))
+	req.Header.Set("X-Luncher-Timestamp", timestamp)
+	req.Header.Set("X-Luncher-Signature", "sha256="+hex.EncodeToString(signature.Sum(nil)))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	return resp.StatusCode, nil
+}